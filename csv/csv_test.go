@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func EncodeCSV(records [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var csvBufPool = &sync.Pool{
+	New: func() interface{} {
+		return &bytes.Buffer{}
+	},
+}
+
+// csvWriter はcsv.Writerの書き込み先を差し替えられるようにしたもの
+// csv.WriterにはResetがないので、自分自身をio.Writerとして渡しておき、
+// 書き込みをwに転送することでcsv.Writer(と中のbufio.Writer)ごとPoolで使いまわす
+type csvWriter struct {
+	w  io.Writer
+	cw *csv.Writer
+}
+
+func (c *csvWriter) Write(p []byte) (int, error) {
+	return c.w.Write(p)
+}
+
+var csvWriterPool = &sync.Pool{
+	New: func() interface{} {
+		c := &csvWriter{}
+		c.cw = csv.NewWriter(c)
+		return c
+	},
+}
+
+// EncodeCSVWithPool はrecordsをCSVにする。返り値はPoolのbufからコピーしたもの
+func EncodeCSVWithPool(records [][]string) ([]byte, error) {
+	buf := csvBufPool.Get().(*bytes.Buffer)
+	defer csvBufPool.Put(buf)
+	buf.Reset() // 前のデータが残ったままなのでresetする
+
+	c := csvWriterPool.Get().(*csvWriter)
+	c.w = buf
+	// WriteAllは最後にFlushするので、中のbufio.Writerに前のデータは残らない
+	err := c.cw.WriteAll(records)
+	c.w = nil // 呼び出し元のbufを参照し続けないようにする
+	if err != nil {
+		// 書き込みに失敗したcsv.Writerは中のbufio.Writerがエラーを保持し続けるので、Poolに戻さずに捨てる
+		return nil, err
+	}
+	csvWriterPool.Put(c)
+
+	res := make([]byte, buf.Len())
+	copy(res, buf.Bytes())
+	return res, nil
+}
+
+var records = [][]string{
+	{"id", "name", "items"},
+	{"1", "Jack", "knife,shield,herbs"},
+	{"2", "Emma", `"bow"`},
+}
+
+func TestEncodeCSV(t *testing.T) {
+	want := "id,name,items\n1,Jack,\"knife,shield,herbs\"\n2,Emma,\"\"\"bow\"\"\"\n"
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		t.Run("EncodeCSV", func(t *testing.T) {
+			got, err := EncodeCSV(records)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want {
+				t.Errorf("got: %s, want: %s", got, want)
+			}
+		})
+		t.Run("EncodeCSVWithPool", func(t *testing.T) {
+			got, err := EncodeCSVWithPool(records)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want {
+				t.Errorf("got: %s, want: %s", got, want)
+			}
+			// csv.Readerで読むと元のrecordsに戻る
+			read, err := csv.NewReader(bytes.NewReader(got)).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(read, records) {
+				t.Errorf("got: %v, want: %v", read, records)
+			}
+		})
+	}
+
+	// 返り値はPoolのbufからコピーしているので、次の呼び出しで書き換えられない
+	first, _ := EncodeCSVWithPool(records)
+	EncodeCSVWithPool([][]string{{"x", "y", "z"}, {"x", "y", "z"}, {"x", "y", "z"}})
+	if string(first) != want {
+		t.Errorf("first result was modified: %s", first)
+	}
+}
+
+func TestEncodeCSVWithPoolAllocs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	EncodeCSVWithPool(records)
+	withPool := testing.AllocsPerRun(100, func() {
+		Result, _ = EncodeCSVWithPool(records)
+	})
+	withoutPool := testing.AllocsPerRun(100, func() {
+		Result, _ = EncodeCSV(records)
+	})
+	t.Logf("allocs: EncodeCSV %v, EncodeCSVWithPool %v", withoutPool, withPool)
+	// Poolを使うとcsv.Writer、中のbufio.Writer、bytes.Bufferのアロケーションがなくなり、返り値のコピーだけになる
+	if withPool != 1 {
+		t.Errorf("EncodeCSVWithPool: got %v allocs, want 1", withPool)
+	}
+	if withPool >= withoutPool {
+		t.Errorf("EncodeCSVWithPool allocs %v, want fewer than EncodeCSV %v", withPool, withoutPool)
+	}
+}
+
+var Result []byte
+
+func BenchmarkEncodeCSV(b *testing.B) {
+	b.ReportAllocs()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		r, _ = EncodeCSV(records)
+	}
+	Result = r
+}
+
+func BenchmarkEncodeCSVWithPool(b *testing.B) {
+	b.ReportAllocs()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		r, _ = EncodeCSVWithPool(records)
+	}
+	Result = r
+}
+
+// $go test -bench .
+// goos: linux
+// goarch: amd64
+// cpu: Intel(R) Xeon(R) Processor
+// BenchmarkEncodeCSV         	 1334071	       859.5 ns/op	    4208 B/op	       3 allocs/op
+// BenchmarkEncodeCSVWithPool 	 3902325	       318.9 ns/op	      64 B/op	       1 allocs/op
+// EncodeCSVの4208Bのほとんどはcsv.NewWriterの中のbufio.Writer(4096B)
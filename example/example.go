@@ -6,6 +6,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"strings"
 	"sync"
 	"time"
 )
@@ -26,11 +27,15 @@ func timeNow() time.Time {
 	return time.Unix(1136214245, 0) // 2006-01-02T15:04:05Z
 }
 
+// logClock はLogが時刻を取る関数。テストで本物のtime.Nowに差し替えられるようにしておく
+var logClock = timeNow
+
 func Log(w io.Writer, key, val string) {
 	b := bufPool.Get().(*bytes.Buffer)
 	b.Reset()
 	// Replace this with time.Now() in a real logger.
-	b.WriteString(timeNow().UTC().Format(time.RFC3339))
+	// Formatは毎回stringを確保するので、AppendFormatでPoolのbufの空いている所に直接書き込む
+	b.Write(logClock().UTC().AppendFormat(b.AvailableBuffer(), time.RFC3339))
 	b.WriteByte(' ')
 	b.WriteString(key)
 	b.WriteByte('=')
@@ -56,6 +61,68 @@ func LogWithoutPool(w io.Writer, key, val string) {
 	}
 }
 
+// KV はLogToStringに渡すkeyとvalの組
+type KV struct {
+	Key string
+	Val string
+}
+
+var builderPool = sync.Pool{
+	New: func() interface{} {
+		return new(strings.Builder)
+	},
+}
+
+// logLen はfieldsを書き込んだ時の長さ
+func logLen(fields []KV) int {
+	n := len(time.RFC3339)
+	for _, f := range fields {
+		n += 1 + len(f.Key) + 1 + len(f.Val)
+	}
+	return n
+}
+
+// LogToString はLogと同じ形式の行をstringで返す
+// strings.BuilderのString()は中のbufをコピーせずにそのままstringとして返すので、
+// String()を呼んだ後にBuilderへ書き込むと返したstringが書き換わってしまう
+// そのためString()は最後に呼び、その後すぐResetしてPoolに戻す
+// ResetはbufをnilにするだけなのでPoolで使い回せるのはBuilder自体で、bufは毎回Growで確保する
+func LogToString(fields ...KV) string {
+	b := builderPool.Get().(*strings.Builder)
+	b.Reset()
+	b.Grow(logLen(fields))
+	// Replace this with time.Now() in a real logger.
+	b.WriteString(timeNow().UTC().Format(time.RFC3339))
+	for _, f := range fields {
+		b.WriteByte(' ')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		b.WriteString(f.Val)
+	}
+	s := b.String()
+	b.Reset() // 返したstringとbufを共有しないように、Putする前に手放す
+	builderPool.Put(b)
+	return s
+}
+
+// LogToStringの比較用にbytes.Bufferを使った版
+// bytes.BufferのString()はコピーを返すので、bufはそのままPoolで使い回せる
+func LogToStringWithBuffer(fields ...KV) string {
+	b := bufPool.Get().(*bytes.Buffer)
+	b.Reset()
+	// Replace this with time.Now() in a real logger.
+	b.WriteString(timeNow().UTC().Format(time.RFC3339))
+	for _, f := range fields {
+		b.WriteByte(' ')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		b.WriteString(f.Val)
+	}
+	s := b.String()
+	bufPool.Put(b)
+	return s
+}
+
 func main() {
 	Log(os.Stdout, "path", "/search?q=flowers")
 	fmt.Println() // 改行
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestLog(t *testing.T) {
@@ -66,6 +67,100 @@ func BenchmarkLogWithoutPool(b *testing.B) {
 	globalBuf = buf
 }
 
+func TestLogAllocBudget(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	// Benchmarkの結果(Log: 0 allocs/op, LogWithoutPool: 3 allocs/op)が
+	// 変わっていないことをgo testで確認できるようにする
+	// Benchmarkと同じく、書き込み先をglobalBufに入れてコンパイラの最適化で消されないようにする
+	buf := &bytes.Buffer{}
+	logAllocs := testing.AllocsPerRun(100, func() {
+		buf.Reset()
+		Log(buf, "this_path", "/test?q=query&format=json&groupid=100001&area=200000001")
+	})
+	globalBuf = buf
+	if logAllocs > 0 {
+		t.Errorf("Log allocs: %v, want: 0", logAllocs)
+	}
+
+	buf = &bytes.Buffer{}
+	withoutPoolAllocs := testing.AllocsPerRun(100, func() {
+		buf.Reset()
+		LogWithoutPool(buf, "this_path", "/test?q=query&format=json&groupid=100001&area=200000001")
+	})
+	globalBuf = buf
+	if withoutPoolAllocs < 3 {
+		t.Errorf("LogWithoutPool allocs: %v, want: >= 3", withoutPoolAllocs)
+	}
+}
+
+func TestLogToString(t *testing.T) {
+	fields := []KV{{"test_path", "/test?q=balls"}, {"user", "jack"}}
+	want := "2006-01-02T15:04:05Z test_path=/test?q=balls user=jack"
+
+	var results []string
+	for i := 0; i < 2; i++ {
+		t.Run("LogToString"+fmt.Sprintf("%d", i), func(t *testing.T) {
+			got := LogToString(fields...)
+			if got != want {
+				t.Errorf("got: %s, want: %s", got, want)
+			}
+			results = append(results, got)
+		})
+		t.Run("LogToStringWithBuffer"+fmt.Sprintf("%d", i), func(t *testing.T) {
+			got := LogToStringWithBuffer(fields...)
+			if got != want {
+				t.Errorf("got: %s, want: %s", got, want)
+			}
+			results = append(results, got)
+		})
+	}
+
+	// 前に返したstringが後の呼び出しで書き換わっていない
+	LogToString(KV{"other", "value"})
+	LogToStringWithBuffer(KV{"other", "value"})
+	for _, r := range results {
+		if r != want {
+			t.Errorf("result changed after another call: %s", r)
+		}
+	}
+
+	if got, want := LogToString(), "2006-01-02T15:04:05Z"; got != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+}
+
+// strings.Builderは最後のString()でコピーしない代わりに、ResetでbufをnilにするのでGrowで毎回確保する
+// bytes.Bufferはbufを使い回せる代わりに、String()でコピーする
+// どちらも結果のstring分の1回とtime.Formatの1回で、アロケーションの回数は変わらない
+// BenchmarkLogToString                     6653530               171.8 ns/op           136 B/op          2 allocs/op
+// BenchmarkLogToStringWithBuffer           8211615               158.7 ns/op           120 B/op          2 allocs/op
+var globalStr string
+
+var benchFields = []KV{
+	{"this_path", "/test?q=query&format=json&groupid=100001&area=200000001"},
+	{"user", "jack"},
+}
+
+func BenchmarkLogToString(b *testing.B) {
+	b.ReportAllocs()
+	var s string
+	for n := 0; n < b.N; n++ {
+		s = LogToString(benchFields...)
+	}
+	globalStr = s
+}
+
+func BenchmarkLogToStringWithBuffer(b *testing.B) {
+	b.ReportAllocs()
+	var s string
+	for n := 0; n < b.N; n++ {
+		s = LogToStringWithBuffer(benchFields...)
+	}
+	globalStr = s
+}
+
 // $go test -bench . -benchmem -count=4
 // goos: linux
 // goarch: amd64
@@ -80,3 +175,45 @@ func BenchmarkLogWithoutPool(b *testing.B) {
 // BenchmarkLogWithoutPool-8        2785072               411 ns/op             547 B/op          3 allocs/op
 // PASS
 // ok      github.com/ludwig125/sync-pool/example  12.380s
+//
+// LogでFormatの代わりにAppendFormatを使うようにした後
+// BenchmarkLog            	 6654264	       202.8 ns/op	     242 B/op	       0 allocs/op
+// BenchmarkLogWithoutPool 	 4896132	       308.6 ns/op	     544 B/op	       3 allocs/op
+// 上の結果のLogの1 allocsはFormatが返す時刻のstringだった
+
+func TestLogAppendFormat(t *testing.T) {
+	defer func(c func() time.Time) { logClock = c }(logClock)
+
+	// LogはAppendFormatで時刻を書き込むので、time.Formatと同じ文字列になることを確認する
+	jst := time.FixedZone("JST", 9*60*60)
+	for _, now := range []time.Time{
+		timeNow(),
+		time.Date(2023, 12, 31, 23, 59, 59, 999999999, jst),
+		time.Date(1999, 1, 2, 3, 4, 5, 0, time.UTC),
+		time.Now(),
+	} {
+		logClock = func() time.Time { return now }
+		for i := 0; i < 2; i++ {
+			buf := &bytes.Buffer{}
+			Log(buf, "k", "v")
+			if want := now.UTC().Format(time.RFC3339) + " k=v"; buf.String() != want {
+				t.Errorf("got: %s, want: %s", buf.String(), want)
+			}
+		}
+	}
+
+	if testing.Short() {
+		return
+	}
+	// 固定の時刻でなく本物のtime.Nowでも、時刻の文字列を確保しない
+	logClock = time.Now
+	buf := &bytes.Buffer{}
+	allocs := testing.AllocsPerRun(100, func() {
+		buf.Reset()
+		Log(buf, "this_path", "/test?q=query&format=json&groupid=100001&area=200000001")
+	})
+	globalBuf = buf
+	if allocs > 0 {
+		t.Errorf("Log allocs with time.Now: %v, want: 0", allocs)
+	}
+}
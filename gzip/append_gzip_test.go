@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// AppendGzip はdataをgzipした結果をdstの後ろに追加して返す
+// PoolのgzipWriterのbufはPutする前にdstへ追加するので、返り値がPoolのメモリを参照することはない
+// dstのcapが十分あれば、呼び出しごとのアロケーションも発生しない
+func AppendGzip(dst []byte, data []byte) ([]byte, error) {
+	gw := gzipWriterPool.Get().(*gzipWriter)
+	defer gzipWriterPool.Put(gw)
+	gw.buf.Reset()
+	gw.w.Reset(gw.buf)
+
+	if err := gzipWriteClose(gw.w, data); err != nil {
+		return dst, err
+	}
+
+	return append(dst, gw.buf.Bytes()...), nil
+}
+
+func TestAppendGzip(t *testing.T) {
+	prefix := []byte("prefix")
+	dst := append([]byte{}, prefix...)
+
+	var sizes []int
+	for i := 0; i < 3; i++ {
+		before := len(dst)
+		var err error
+		dst, err = AppendGzip(dst, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(dst)-before)
+	}
+
+	if !bytes.HasPrefix(dst, prefix) {
+		t.Errorf("dst lost prefix: %q", dst[:len(prefix)])
+	}
+
+	// 追加したそれぞれのgzipが元のデータに戻せる
+	off := len(prefix)
+	for _, size := range sizes {
+		got, err := Gunzip(bytes.NewReader(dst[off : off+size]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Errorf("got: %s, want: %s", string(got), data)
+		}
+		off += size
+	}
+}
+
+const appendBlobs = 100
+
+func BenchmarkGzipWithGzipWriterPoolMany(b *testing.B) {
+	in := []byte(data)
+	b.ReportAllocs()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		var dst []byte
+		for i := 0; i < appendBlobs; i++ {
+			res, _ := GzipWithGzipWriterPool(in)
+			dst = append(dst, res...)
+		}
+		r = dst
+	}
+	Result = r
+}
+
+func BenchmarkAppendGzip(b *testing.B) {
+	in := []byte(data)
+	b.ReportAllocs()
+	var dst []byte
+	for n := 0; n < b.N; n++ {
+		dst = dst[:0]
+		for i := 0; i < appendBlobs; i++ {
+			dst, _ = AppendGzip(dst, in)
+		}
+	}
+	Result = dst
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"testing/iotest"
+)
+
+var errAutoDecompressReaderClosed = errors.New("autoDecompressReader is already closed")
+
+var bufioReaderPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewReader(nil)
+	},
+}
+
+type autoDecompressReader struct {
+	br     *bufio.Reader
+	gr     *gzipReader // gzipでないときはnil
+	closed bool
+}
+
+func (a *autoDecompressReader) Read(p []byte) (int, error) {
+	if a.closed {
+		return 0, errAutoDecompressReaderClosed
+	}
+	if a.gr != nil {
+		return a.gr.r.Read(p)
+	}
+	return a.br.Read(p)
+}
+
+// Close はbufio.ReaderとgzipReaderをPoolに戻す。2回目以降のCloseは何もしない
+func (a *autoDecompressReader) Close() error {
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	var err error
+	if a.gr != nil {
+		err = a.gr.r.Close()
+		gzipReaderPool.Put(a.gr)
+		a.gr = nil
+	}
+	a.br.Reset(nil) // Poolに戻した後に呼び出し元のReaderを参照し続けないようにする
+	bufioReaderPool.Put(a.br)
+	a.br = nil
+	return err
+}
+
+// NewAutoDecompressReader はrがgzipなら展開しながら、そうでなければそのまま読むReaderを返す
+// gzipかどうかはPoolのbufio.Readerで先頭の2バイトをPeekして判断するので、gzipでないときも先頭のバイトは失われない
+// 読み終わったら必ずCloseして、Poolのbufio.ReaderとgzipReaderを戻すこと
+func NewAutoDecompressReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufioReaderPool.Get().(*bufio.Reader)
+	br.Reset(r)
+	a := &autoDecompressReader{br: br}
+
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		a.Close()
+		return nil, fmt.Errorf("%w: failed to Peek: %w", ErrRead, err)
+	}
+	// 2バイトに満たない入力はgzipではないので、そのまま読む
+	if len(magic) < 2 || magic[0] != gzipID1 || magic[1] != gzipID2 {
+		return a, nil
+	}
+
+	gr := gzipReaderPool.Get().(*gzipReader)
+	if gr.err != nil {
+		a.Close()
+		return nil, fmt.Errorf("%w: failed to Get gzipReaderPool: %w", ErrDecompress, gr.err)
+	}
+	// bufio.Readerはio.ByteReaderなので、Resetの中でさらにbufio.Readerを作られない
+	if err := gr.r.Reset(br); err != nil {
+		// 次に使う時にResetしなおすので、失敗したものもPoolに戻してよい
+		gzipReaderPool.Put(gr)
+		a.Close()
+		return nil, fmt.Errorf("%w: failed to Reset gzip Reader: %w", ErrDecompress, err)
+	}
+	a.gr = gr
+	return a, nil
+}
+
+func TestNewAutoDecompressReader(t *testing.T) {
+	compressed, err := Gzip([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		in   []byte
+		want []byte
+	}{
+		"gzipped": {in: compressed, want: []byte(data)},
+		"plain":   {in: []byte(data), want: []byte(data)},
+		// 先頭の1バイトだけgzipのmagic numberと同じ
+		"plain_starting_with_id1": {in: []byte{gzipID1, 'a', 'b'}, want: []byte{gzipID1, 'a', 'b'}},
+		"one_byte":                {in: []byte{gzipID1}, want: []byte{gzipID1}},
+		"empty":                   {in: []byte{}, want: []byte{}},
+	}
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		for name, tc := range tests {
+			t.Run(name, func(t *testing.T) {
+				// 1バイトずつしか返さないReaderでも、Peekした分が失われないことを確認する
+				rc, err := NewAutoDecompressReader(iotest.OneByteReader(bytes.NewReader(tc.in)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := io.ReadAll(rc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := rc.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, tc.want) {
+					t.Errorf("got: %q, want: %q", got, tc.want)
+				}
+				if _, err := rc.Read(make([]byte, 1)); !errors.Is(err, errAutoDecompressReaderClosed) {
+					t.Errorf("Read after Close: got %v, want %v", err, errAutoDecompressReaderClosed)
+				}
+			})
+		}
+	}
+
+	// magic numberは合っているがヘッダが途中で切れている
+	if _, err := NewAutoDecompressReader(bytes.NewReader([]byte{gzipID1, gzipID2, 0})); !errors.Is(err, ErrDecompress) {
+		t.Errorf("got %v, want %v", err, ErrDecompress)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// base64の作業用の[]byteのPool
+var blobScratchPool = NewBytePool(1 << 20)
+
+// EncodeBlobField はdataをgzipしてからbase64にした文字列を返す
+// 圧縮したバイナリをJSONの文字列フィールドに入れるときに使う
+// gzipはgzipWriterPool、base64はblobScratchPoolの[]byteを使い、返り値のstringを作る時だけアロケーションする
+func EncodeBlobField(data []byte) (string, error) {
+	return encodeGzipBase64(base64.StdEncoding, data, 0)
+}
+
+// DecodeBlobField はEncodeBlobFieldで作った文字列を元のデータに戻す。返り値はPoolのbufからコピーしたもの
+func DecodeBlobField(s string) ([]byte, error) {
+	return decodeGzipBase64(base64.StdEncoding, s)
+}
+
+// encodeGzipBase64 はdataをgzipしてからencでbase64にする
+// maxLenが0より大きいときは、base64にした長さがmaxLenを超えたらErrValueTooLongを返す
+func encodeGzipBase64(enc *base64.Encoding, data []byte, maxLen int) (string, error) {
+	gw := gzipWriterPool.Get().(*gzipWriter)
+	gw.markGet()
+	defer putUnlessPanic(&gzipWriterPool, gw)
+	gw.buf.Reset()
+	gw.w.Reset(gw.buf)
+
+	if _, err := gw.w.Write(data); err != nil {
+		return "", fmt.Errorf("%w: failed to gzip Write: %w", ErrCompress, err)
+	}
+	if err := gw.w.Close(); err != nil {
+		return "", fmt.Errorf("%w: failed to gzip Close: %w", ErrCompress, err)
+	}
+
+	compressed := gw.buf.Bytes()
+	n := enc.EncodedLen(len(compressed))
+	if maxLen > 0 && n > maxLen {
+		return "", fmt.Errorf("%w: encoded length %d exceeds %d", ErrValueTooLong, n, maxLen)
+	}
+	scratch := blobScratchPool.Get(n)
+	scratch = enc.AppendEncode(scratch, compressed)
+	s := string(scratch)
+	blobScratchPool.Put(scratch)
+	return s, nil
+}
+
+// decodeGzipBase64 はencodeGzipBase64で作った文字列を元のデータに戻す。返り値はPoolのbufからコピーしたもの
+func decodeGzipBase64(enc *base64.Encoding, s string) ([]byte, error) {
+	// base64.DecodeStringは結果の[]byteを毎回確保するので、Poolの[]byteに文字列をコピーしてからデコードする
+	src := blobScratchPool.Get(len(s))
+	defer func() { blobScratchPool.Put(src) }()
+	src = append(src, s...)
+	compressed := blobScratchPool.Get(enc.DecodedLen(len(src)))
+	defer func() { blobScratchPool.Put(compressed) }()
+	compressed, err := enc.AppendDecode(compressed, src)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode base64: %w", ErrDecompress, err)
+	}
+
+	gr := gzipReaderPool.Get().(*gzipReader)
+	if gr.err != nil {
+		return nil, fmt.Errorf("%w: failed to Get gzipReaderPool: %w", ErrDecompress, gr.err)
+	}
+	defer gzipReaderPool.Put(gr)
+	defer gr.in.Reset(nil)
+	defer gr.r.Close()
+	gr.buf.Reset()
+	gr.in.Reset(compressed)
+	if err := gr.r.Reset(&gr.in); err != nil {
+		return nil, fmt.Errorf("%w: failed to Reset gzip Reader: %w", ErrDecompress, err)
+	}
+	if _, err := gr.buf.ReadFrom(gr.r); err != nil {
+		return nil, fmt.Errorf("%w: failed to read gzip Reader: %w", ErrDecompress, err)
+	}
+
+	res := make([]byte, gr.buf.Len())
+	copy(res, gr.buf.Bytes())
+	return res, nil
+}
+
+// 標準ライブラリをそのまま組み合わせた場合
+func encodeBlobFieldNaive(data []byte) (string, error) {
+	compressed, err := Gzip(data)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(compressed), nil
+}
+
+func decodeBlobFieldNaive(s string) ([]byte, error) {
+	compressed, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(gr)
+}
+
+func TestBlobField(t *testing.T) {
+	inputs := [][]byte{[]byte(data), {}, bytes.Repeat([]byte{0, 1, 2, 0xff}, 10000)}
+
+	for i := 0; i < 2; i++ {
+		for _, in := range inputs {
+			s, err := EncodeBlobField(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 標準ライブラリで作った文字列と同じ形式で、お互いに戻せる
+			naive, err := decodeBlobFieldNaive(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(naive, in) {
+				t.Errorf("naive decode: got %d bytes, want %d bytes", len(naive), len(in))
+			}
+			got, err := DecodeBlobField(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, in) {
+				t.Errorf("got %d bytes, want %d bytes", len(got), len(in))
+			}
+		}
+	}
+
+	if _, err := DecodeBlobField("!!not base64!!"); err == nil {
+		t.Error("want error for invalid base64")
+	}
+}
+
+var blobResult string
+
+// go test -run XX -bench 'BlobField' .
+// BenchmarkEncodeBlobFieldNaive 	    9273	    124706 ns/op	 1076960 B/op	      20 allocs/op
+// BenchmarkEncodeBlobField      	  175808	      6870 ns/op	     208 B/op	       1 allocs/op
+// BenchmarkDecodeBlobFieldNaive 	  142802	      8489 ns/op	   41904 B/op	       8 allocs/op
+// BenchmarkDecodeBlobField      	  334756	      3514 ns/op	     176 B/op	       1 allocs/op
+// Pool版の1 allocsは返り値のstringと[]byteのコピー
+
+func BenchmarkEncodeBlobFieldNaive(b *testing.B) {
+	in := []byte(data)
+	b.ReportAllocs()
+	var r string
+	for n := 0; n < b.N; n++ {
+		r, _ = encodeBlobFieldNaive(in)
+	}
+	blobResult = r
+}
+
+func BenchmarkEncodeBlobField(b *testing.B) {
+	in := []byte(data)
+	b.ReportAllocs()
+	var r string
+	for n := 0; n < b.N; n++ {
+		r, _ = EncodeBlobField(in)
+	}
+	blobResult = r
+}
+
+func BenchmarkDecodeBlobFieldNaive(b *testing.B) {
+	s, _ := EncodeBlobField([]byte(data))
+	b.ReportAllocs()
+	b.ResetTimer()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		r, _ = decodeBlobFieldNaive(s)
+	}
+	Result = r
+}
+
+func BenchmarkDecodeBlobField(b *testing.B) {
+	s, _ := EncodeBlobField([]byte(data))
+	b.ReportAllocs()
+	b.ResetTimer()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		r, _ = DecodeBlobField(s)
+	}
+	Result = r
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errBoundedPoolPut = errors.New("BoundedPool.Put was called without a matching Get")
+
+// BoundedPool は同時に貸し出せる数をmaxInUseまでに制限したPool
+// gzip.Writerのようにメモリを多く使うものを使うときに、ピーク時のメモリ使用量を抑えるために使う
+type BoundedPool struct {
+	pool sync.Pool
+	sem  chan struct{}
+}
+
+func NewBoundedPool(maxInUse int, newFunc func() interface{}) *BoundedPool {
+	return &BoundedPool{
+		pool: sync.Pool{New: newFunc},
+		sem:  make(chan struct{}, maxInUse),
+	}
+}
+
+// Get はmaxInUse個が貸し出し中のときは、どれかがPutされるまでブロックする
+func (p *BoundedPool) Get() interface{} {
+	p.sem <- struct{}{}
+	return p.pool.Get()
+}
+
+// Put はPoolに値を戻して、貸し出し枠を1つ空ける
+// 貸し出し中のものがないのにPutするとブロックしてしまうので、その時はPoolに戻さずにpanicする
+func (p *BoundedPool) Put(x interface{}) {
+	select {
+	case <-p.sem:
+	default:
+		panic(errBoundedPoolPut)
+	}
+	p.pool.Put(x)
+}
+
+type GzipperWithBoundedPool struct {
+	GzipWriterPool *BoundedPool
+}
+
+func NewGzipperWithBoundedPool(maxInUse int) *GzipperWithBoundedPool {
+	return &GzipperWithBoundedPool{
+		GzipWriterPool: NewBoundedPool(maxInUse, func() interface{} {
+			buf := &bytes.Buffer{}
+			w := gzip.NewWriter(buf)
+			return &gzipWriter{
+				w:   w,
+				buf: buf,
+			}
+		}),
+	}
+}
+
+func (g *GzipperWithBoundedPool) Gzip(data []byte) ([]byte, error) {
+	gw := g.GzipWriterPool.Get().(*gzipWriter)
+	defer g.GzipWriterPool.Put(gw)
+	gw.buf.Reset()
+	gw.w.Reset(gw.buf)
+
+	if err := gzipWriteClose(gw.w, data); err != nil {
+		return nil, err
+	}
+
+	// Put後に他のgoroutineに上書きされないようにコピーして返す
+	res := make([]byte, gw.buf.Len())
+	copy(res, gw.buf.Bytes())
+	return res, nil
+}
+
+func TestBoundedPool(t *testing.T) {
+	p := NewBoundedPool(2, func() interface{} {
+		return new(int)
+	})
+
+	acquired := make(chan interface{})
+	for i := 0; i < 4; i++ {
+		go func() {
+			acquired <- p.Get()
+		}()
+	}
+
+	// 2つまでは貸し出せる
+	var got []interface{}
+	for i := 0; i < 2; i++ {
+		select {
+		case x := <-acquired:
+			got = append(got, x)
+		case <-time.After(time.Second):
+			t.Fatalf("Get %d blocked", i+1)
+		}
+	}
+
+	// 3つ目はPutされるまでブロックする
+	select {
+	case <-acquired:
+		t.Fatal("3rd Get should block until Put")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	for i := 0; i < 2; i++ {
+		p.Put(got[i])
+		select {
+		case <-acquired:
+		case <-time.After(time.Second):
+			t.Fatalf("Get %d blocked after Put", i+3)
+		}
+	}
+}
+
+func TestBoundedPoolPutWithoutGet(t *testing.T) {
+	p := NewBoundedPool(1, func() interface{} {
+		return new(int)
+	})
+	p.Put(p.Get())
+
+	defer func() {
+		if r := recover(); r != errBoundedPoolPut {
+			t.Errorf("recovered: %v, want: %v", r, errBoundedPoolPut)
+		}
+		// panicした後も貸し出し枠は減っていないので、Getできる
+		done := make(chan struct{})
+		go func() {
+			p.Get()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("Get blocked after the misused Put")
+		}
+	}()
+	p.Put(new(int))
+	t.Error("want panic")
+}
+
+func TestGzipperWithBoundedPool(t *testing.T) {
+	g := NewGzipperWithBoundedPool(2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := g.Gzip([]byte(data))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			got, err := Gunzip(bytes.NewBuffer(res))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if string(got) != data {
+				t.Errorf("got: %s, want: %s", string(got), data)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkGzipperWithBoundedPool(b *testing.B) {
+	g := NewGzipperWithBoundedPool(2)
+	b.ResetTimer()
+	b.ReportAllocs()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		r, _ = g.Gzip([]byte(data))
+	}
+	Result = r
+}
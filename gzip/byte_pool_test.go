@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+// BytePool は一時的に使う[]byteを使いまわすためのPool
+// base64やhexなどのエンコード処理で作業用の[]byteが必要なときに使う
+type BytePool struct {
+	// MaxCap よりcapが大きいsliceはPutしてもPoolに戻さずに捨てる
+	// 一度だけ大きなデータを扱ったときに、大きなsliceがPoolに残り続けないようにするため
+	MaxCap int
+
+	pool sync.Pool // 中身の入った*[]byte
+	// []byteをそのままinterface{}に入れるとPutのたびにアロケーションが発生するので、
+	// 入れ物の*[]byteも使いまわす
+	holders sync.Pool
+}
+
+func NewBytePool(maxCap int) *BytePool {
+	return &BytePool{
+		MaxCap: maxCap,
+	}
+}
+
+// Get はcapがminCap以上で長さ0のsliceを返す
+func (p *BytePool) Get(minCap int) []byte {
+	if x := p.pool.Get(); x != nil {
+		h := x.(*[]byte)
+		b := *h
+		*h = nil
+		p.holders.Put(h)
+		if cap(b) >= minCap {
+			return b[:0]
+		}
+		// capが足りないものは捨てて新しく作る
+	}
+	return make([]byte, 0, minCap)
+}
+
+// Put はbをPoolに戻す。Put後にbを使ってはいけない
+func (p *BytePool) Put(b []byte) {
+	if cap(b) == 0 || cap(b) > p.MaxCap {
+		return
+	}
+	h, ok := p.holders.Get().(*[]byte)
+	if !ok {
+		h = new([]byte)
+	}
+	*h = b[:0]
+	p.pool.Put(h)
+}
+
+func TestBytePool(t *testing.T) {
+	t.Run("capacity", func(t *testing.T) {
+		p := NewBytePool(1024)
+		for _, minCap := range []int{0, 1, 10, 100, 2048} {
+			b := p.Get(minCap)
+			if len(b) != 0 {
+				t.Errorf("len: %d, want: 0", len(b))
+			}
+			if cap(b) < minCap {
+				t.Errorf("cap: %d, want: >= %d", cap(b), minCap)
+			}
+			b = append(b, "dirty data"...)
+			p.Put(b)
+		}
+	})
+
+	t.Run("reuse", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+		}
+		p := NewBytePool(1024)
+		b := p.Get(100)
+		b = append(b, "dirty data"...)
+		p.Put(b)
+
+		got := p.Get(10)
+		if len(got) != 0 {
+			t.Errorf("len: %d, want: 0", len(got))
+		}
+		if cap(got) != cap(b) {
+			t.Errorf("cap: %d, want: %d", cap(got), cap(b))
+		}
+	})
+
+	t.Run("drop_oversized", func(t *testing.T) {
+		p := NewBytePool(1024)
+		p.Put(make([]byte, 0, 2048))
+		if got := p.Get(0); cap(got) == 2048 {
+			t.Errorf("got oversized slice cap: %d", cap(got))
+		}
+	})
+
+	t.Run("allocs", func(t *testing.T) {
+		p := NewBytePool(1024)
+		p.Put(p.Get(100))
+		allocs := testing.AllocsPerRun(100, func() {
+			b := p.Get(100)
+			b = append(b, "data"...)
+			p.Put(b)
+		})
+		if allocs != 0 {
+			t.Errorf("allocs: %v, want: 0", allocs)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ChunkCompressor はデータをchunkに分けて並行にgzipし、最後に元の順番でつなげる
+// gzipのmemberはそのままつなげても正しいgzipになるので、展開する側はMultistreamで読めば元のデータに戻る
+// 複数のgoroutineから同時にCompressしてよい
+type ChunkCompressor struct {
+	mu     sync.Mutex
+	chunks [][]byte
+}
+
+// Compress はindex番目のchunkとしてdataをgzipして保存する
+// gzipはPoolのgzipWriterを使い、結果はコピーして持つ
+func (c *ChunkCompressor) Compress(index int, data []byte) error {
+	compressed, err := gzipWithPool(&gzipWriterPool, data)
+	if err != nil {
+		return fmt.Errorf("failed to compress chunk %d: %w", index, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if index >= len(c.chunks) {
+		c.chunks = append(c.chunks, make([][]byte, index+1-len(c.chunks))...)
+	}
+	c.chunks[index] = compressed
+	return nil
+}
+
+// Assemble はindexの順番にchunkをつなげたgzipを返す
+// 全てのCompressが終わってから呼ぶこと。Compressされていないindexは飛ばす
+func (c *ChunkCompressor) Assemble() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, chunk := range c.chunks {
+		n += len(chunk)
+	}
+	res := make([]byte, 0, n)
+	for _, chunk := range c.chunks {
+		res = append(res, chunk...)
+	}
+	return res
+}
+
+// go test -race -run ChunkCompressor で実行して、並行にCompressしても競合しないことを確認する
+func TestChunkCompressor(t *testing.T) {
+	const numChunks = 16
+	var chunks [][]byte
+	var want []byte
+	for i := 0; i < numChunks; i++ {
+		chunk := []byte(fmt.Sprintf("chunk %02d: %s\n", i, data))
+		chunks = append(chunks, chunk)
+		want = append(want, chunk...)
+	}
+
+	for i := 0; i < 2; i++ {
+		c := &ChunkCompressor{}
+		var wg sync.WaitGroup
+		errs := make(chan error, numChunks)
+		// 後ろのchunkから順に起動し、さらにランダムに待たせて、終わる順番をばらばらにする
+		for i := numChunks - 1; i >= 0; i-- {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				time.Sleep(time.Duration(rand.Intn(1000)) * time.Microsecond)
+				if err := c.Compress(i, chunks[i]); err != nil {
+					errs <- err
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatal(err)
+		}
+
+		got, err := GunzipMultistream(bytes.NewReader(c.Assemble()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("got: %s, want: %s", got, want)
+		}
+	}
+}
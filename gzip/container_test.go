@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// コンテナの先頭に書くマジックナンバー
+const containerMagic = "GSPC"
+
+var (
+	ErrContainerMagic    = errors.New("container magic mismatch")
+	ErrContainerChecksum = errors.New("container checksum mismatch")
+	errContainerClosed   = errors.New("container is already closed")
+)
+
+// crc32Pool はContainerWriterとContainerReaderが展開後のデータのCRC32を計算するhash.Hash32のPool
+var crc32Pool = sync.Pool{
+	New: func() interface{} {
+		return crc32.NewIEEE()
+	},
+}
+
+// ContainerWriter はマジックナンバー、gzipしたデータ、展開後のデータのCRC32(ビッグエンディアン4バイト)の順に書き込む
+// gzipWriterNoBufとhash.Hash32はPoolから取って、Closeした時にPoolに戻す
+// 並行に使うことはできない
+type ContainerWriter struct {
+	w           io.Writer
+	gw          *gzipWriterNoBuf
+	h           hash.Hash32
+	wroteHeader bool
+}
+
+func NewContainerWriter(w io.Writer) *ContainerWriter {
+	h := crc32Pool.Get().(hash.Hash32)
+	h.Reset()
+	return &ContainerWriter{w: w, gw: getGzipWriterNoBuf(w), h: h}
+}
+
+// writeHeader はまだ書いていなければマジックナンバーを書き込む
+// gzip.Writerはヘッダを最初のWriteかCloseの時に書くので、その前に呼ぶ
+func (c *ContainerWriter) writeHeader() error {
+	if c.wroteHeader {
+		return nil
+	}
+	c.wroteHeader = true
+	if _, err := io.WriteString(c.w, containerMagic); err != nil {
+		return fmt.Errorf("failed to write container magic: %w", err)
+	}
+	return nil
+}
+
+func (c *ContainerWriter) Write(p []byte) (int, error) {
+	if c.gw == nil {
+		return 0, errContainerClosed
+	}
+	if err := c.writeHeader(); err != nil {
+		return 0, err
+	}
+	n, err := c.gw.w.Write(p)
+	c.h.Write(p[:n])
+	if err != nil {
+		return n, fmt.Errorf("%w: failed to gzip Write: %w", ErrCompress, err)
+	}
+	return n, nil
+}
+
+// Close はgzipのフッタとCRC32を書き込んで、gzipWriterNoBufとhash.Hash32をPoolに戻す
+func (c *ContainerWriter) Close() error {
+	if c.gw == nil {
+		return errContainerClosed
+	}
+	gw, h := c.gw, c.h
+	c.gw, c.h = nil, nil
+	defer crc32Pool.Put(h)
+	defer putGzipWriterNoBuf(gw)
+
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	if err := gw.w.Close(); err != nil {
+		return fmt.Errorf("%w: failed to gzip Close: %w", ErrCompress, err)
+	}
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], h.Sum32())
+	if _, err := c.w.Write(sum[:]); err != nil {
+		return fmt.Errorf("failed to write container checksum: %w", err)
+	}
+	return nil
+}
+
+// ContainerReader はContainerWriterが書いたコンテナを読んで、展開したデータを返すio.Reader
+// 最後まで読んだ時にCRC32を確かめて、合わなければErrContainerChecksumを返す
+// gzipにも展開後のデータのCRC32が入っているので、gzipのデータが壊れているときは先にErrDecompressになる
+// 読み終わったら必ずCloseしてPoolに戻すこと
+type ContainerReader struct {
+	gr  *gzipReader
+	h   hash.Hash32
+	err error // 一度返したio.EOFかエラーを、次のReadでも返す
+}
+
+// NewContainerReader はマジックナンバーを確かめてから、rのgzipしたデータを読むContainerReaderを返す
+func NewContainerReader(r io.Reader) (*ContainerReader, error) {
+	gr := gzipReaderPool.Get().(*gzipReader)
+	if gr.err != nil {
+		return nil, fmt.Errorf("%w: failed to Get gzipReaderPool: %w", ErrDecompress, gr.err)
+	}
+	gr.src.reset(r)
+	// gzip.Readerがio.ByteReaderから読むと、gzipのデータの後ろを読みすぎないので、その後のCRC32を同じbrから読める
+	if gr.br == nil {
+		gr.br = bufio.NewReader(&gr.src)
+	} else {
+		gr.br.Reset(&gr.src)
+	}
+
+	var magic [len(containerMagic)]byte
+	if _, err := io.ReadFull(gr.br, magic[:]); err != nil {
+		err = fmt.Errorf("%w: failed to read container magic: %w", ErrRead, err)
+		putGzipReader(&gzipReaderPool, gr)
+		return nil, err
+	}
+	if string(magic[:]) != containerMagic {
+		putGzipReader(&gzipReaderPool, gr)
+		return nil, fmt.Errorf("%w: got %q", ErrContainerMagic, magic[:])
+	}
+	if err := gr.r.Reset(gr.br); err != nil {
+		err = gr.src.wrapErr("failed to Reset gzip Reader", err)
+		putGzipReader(&gzipReaderPool, gr)
+		return nil, err
+	}
+	gr.r.Multistream(false)
+
+	h := crc32Pool.Get().(hash.Hash32)
+	h.Reset()
+	return &ContainerReader{gr: gr, h: h}, nil
+}
+
+func (c *ContainerReader) Read(p []byte) (int, error) {
+	if c.gr == nil {
+		return 0, errContainerClosed
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.gr.r.Read(p)
+	c.h.Write(p[:n])
+	if err == io.EOF {
+		err = c.verify()
+	} else if err != nil {
+		err = c.gr.src.wrapErr("failed to gzip Read", err)
+	}
+	c.err = err
+	return n, err
+}
+
+// verify はgzipのデータの後ろのCRC32を読んで、展開したデータのCRC32と比べる。合っていればio.EOFを返す
+func (c *ContainerReader) verify() error {
+	var sum [4]byte
+	if _, err := io.ReadFull(c.gr.br, sum[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("%w: failed to read container checksum: %w", ErrRead, err)
+	}
+	if got, want := c.h.Sum32(), binary.BigEndian.Uint32(sum[:]); got != want {
+		return fmt.Errorf("%w: got %08x, want %08x", ErrContainerChecksum, got, want)
+	}
+	return io.EOF
+}
+
+// Close はgzipReaderとhash.Hash32をPoolに戻す。2回目以降のCloseは何もしない
+func (c *ContainerReader) Close() error {
+	if c.gr == nil {
+		return nil
+	}
+	putGzipReader(&gzipReaderPool, c.gr)
+	crc32Pool.Put(c.h)
+	c.gr, c.h = nil, nil
+	return nil
+}
+
+// writeContainer はchunksを順にContainerWriterに書き込んだコンテナを返す
+func writeContainer(t *testing.T, chunks ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewContainerWriter(&buf)
+	for _, c := range chunks {
+		if _, err := io.WriteString(w, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func readContainer(src []byte) ([]byte, error) {
+	r, err := NewContainerReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func TestContainerRoundTrip(t *testing.T) {
+	tests := map[string][]string{
+		"one_chunk":  {data},
+		"chunks":     {"hello ", "container ", "world"},
+		"empty":      nil,
+		"large_text": {strings.Repeat(data, 100)},
+	}
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		for name, chunks := range tests {
+			t.Run(name, func(t *testing.T) {
+				container := writeContainer(t, chunks...)
+				if !bytes.HasPrefix(container, []byte(containerMagic)) {
+					t.Fatalf("container does not start with magic: %q", container[:4])
+				}
+				got, err := readContainer(container)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := strings.Join(chunks, ""); string(got) != want {
+					t.Errorf("got %d bytes, want %d bytes", len(got), len(want))
+				}
+			})
+		}
+	}
+}
+
+func TestContainerCorruption(t *testing.T) {
+	container := writeContainer(t, data)
+	corrupt := func(i int) []byte {
+		b := append([]byte{}, container...)
+		b[i] ^= 0xff
+		return b
+	}
+
+	tests := map[string]struct {
+		src  []byte
+		want error
+	}{
+		// 最後の4バイトがコンテナのCRC32
+		"checksum": {src: corrupt(len(container) - 1), want: ErrContainerChecksum},
+		// gzipのデータの中身を壊すと、コンテナのCRC32より先にgzipのCRC32かdeflateで見つかる
+		"payload":              {src: corrupt(len(containerMagic) + 12), want: ErrDecompress},
+		"magic":                {src: corrupt(0), want: ErrContainerMagic},
+		"truncated_magic":      {src: container[:2], want: ErrRead},
+		"truncated_footer":     {src: container[:len(container)-2], want: ErrRead},
+		"missing_footer":       {src: container[:len(container)-4], want: io.ErrUnexpectedEOF},
+		"not_gzip_after_magic": {src: []byte(containerMagic + "not gzip"), want: ErrDecompress},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := readContainer(tc.src); !errors.Is(err, tc.want) {
+				t.Errorf("got: %v, want: %v", err, tc.want)
+			}
+		})
+	}
+
+	// 壊れたコンテナを読んだ後も、Poolに戻したgzipReaderで正しく読める
+	got, err := readContainer(container)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Errorf("got: %s, want: %s", got, data)
+	}
+}
+
+func TestContainerClosed(t *testing.T) {
+	w := NewContainerWriter(io.Discard)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("x")); !errors.Is(err, errContainerClosed) {
+		t.Errorf("Write after Close: got %v, want %v", err, errContainerClosed)
+	}
+
+	r, err := NewContainerReader(bytes.NewReader(writeContainer(t, "x")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if _, err := r.Read(make([]byte, 1)); !errors.Is(err, errContainerClosed) {
+		t.Errorf("Read after Close: got %v, want %v", err, errContainerClosed)
+	}
+}
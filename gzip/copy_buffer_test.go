@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// io.Copyが中で確保するbufと同じ大きさ
+const defaultCopyBufferSize = 32 * 1024
+
+var copyBufferSize atomic.Int64
+
+func init() {
+	copyBufferSize.Store(defaultCopyBufferSize)
+}
+
+// io.Copyは書き込み先がio.ReaderFromでも読み込み元がio.WriterToでもないときに、呼び出しごとに32KBのbufを確保する
+// ストリーム用の関数ではPoolのbufをio.CopyBufferに渡して、その確保をなくす
+var copyBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, copyBufferSize.Load())
+		return &b
+	},
+}
+
+// SetCopyBufferSize はストリーム用の関数がコピーに使うbufの大きさを変える
+// 変更前の大きさのbufはPoolに戻さずに捨てるので、徐々に新しい大きさに入れ替わる
+func SetCopyBufferSize(n int) {
+	if n <= 0 {
+		n = defaultCopyBufferSize
+	}
+	copyBufferSize.Store(int64(n))
+}
+
+// copyWithPool はPoolのbufを使ってsrcからdstにコピーする
+func copyWithPool(dst io.Writer, src io.Reader) (int64, error) {
+	bp := copyBufPool.Get().(*[]byte)
+	size := int(copyBufferSize.Load())
+	if len(*bp) != size {
+		// SetCopyBufferSizeで大きさが変わる前に作られたbufは使わない
+		b := make([]byte, size)
+		bp = &b
+	}
+	defer func() {
+		if len(*bp) == int(copyBufferSize.Load()) {
+			copyBufPool.Put(bp)
+		}
+	}()
+	return io.CopyBuffer(dst, src, *bp)
+}
+
+// writerOnly はio.ReaderFromなどを隠してWriteだけを見せる
+// io.Copyがbufを使う場合を再現するのに使う
+type writerOnly struct {
+	io.Writer
+}
+
+func TestCopyWithPool(t *testing.T) {
+	defer SetCopyBufferSize(0)
+
+	src := bytes.Repeat([]byte("0123456789"), 10000)
+	for _, size := range []int{defaultCopyBufferSize, 7, 1 << 16} {
+		SetCopyBufferSize(size)
+		for i := 0; i < 2; i++ {
+			var dst bytes.Buffer
+			n, err := copyWithPool(writerOnly{&dst}, bytes.NewReader(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(len(src)) || !bytes.Equal(dst.Bytes(), src) {
+				t.Errorf("size %d: copied %d bytes, want %d", size, n, len(src))
+			}
+		}
+	}
+
+	// 大きさを変えた後は、新しい大きさのbufだけがPoolに戻る
+	SetCopyBufferSize(1024)
+	copyWithPool(io.Discard, bytes.NewReader(src))
+	bp := copyBufPool.Get().(*[]byte)
+	if len(*bp) != 1024 {
+		t.Errorf("pooled buffer size: %d, want: 1024", len(*bp))
+	}
+}
+
+var largeGzippedData = func() []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	for i := 0; i < 10000; i++ {
+		zw.Write([]byte(data))
+	}
+	zw.Close()
+	return buf.Bytes()
+}()
+
+// 1MB程度に展開されるデータを、io.ReaderFromを持たない書き込み先に展開する
+// GunzipLargeStreamToWriterの1 allocはwriterOnlyをio.Writerに変換する分
+// BenchmarkGunzipLargeStreamIoCopy              3951            273598 ns/op           74016 B/op          8 allocs/op
+// BenchmarkGunzipLargeStreamToWriter            4572            262395 ns/op              16 B/op          1 allocs/op
+func BenchmarkGunzipLargeStreamIoCopy(b *testing.B) {
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		gr, err := gzip.NewReader(bytes.NewReader(largeGzippedData))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.Copy(writerOnly{io.Discard}, gr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGunzipLargeStreamToWriter(b *testing.B) {
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if _, err := GunzipToWriter(writerOnly{io.Discard}, largeGzippedData); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
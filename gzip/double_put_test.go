@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+var errDoublePut = errors.New("gzipWriter was put back to the pool twice")
+
+// putMarker はPoolに戻されたかどうかを自分で覚えているオブジェクト
+// putUnlessPanicはPutする前にmarkPutを呼ぶ
+type putMarker interface {
+	markPut()
+}
+
+// markGet はPoolから取り出したことを記録する
+func (gw *gzipWriter) markGet() {
+	if poolDebug {
+		gw.inPool.Store(false)
+	}
+}
+
+// markPut はPoolに戻すことを記録する。既に戻されていたらpanicする
+// 2回Putされると同じgzipWriterが2つのgoroutineに渡されて、お互いのbufを壊してしまう
+func (gw *gzipWriter) markPut() {
+	if poolDebug && gw.inPool.Swap(true) {
+		panic(errDoublePut)
+	}
+}
+
+func TestGzipWriterDoublePut(t *testing.T) {
+	defer func(d bool) { poolDebug = d }(poolDebug)
+	poolDebug = true
+
+	// 通常の使い方では何度呼んでもpanicしない
+	for i := 0; i < 3; i++ {
+		if _, err := GzipWithGzipWriterPool([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gw := gzipWriterPool.Get().(*gzipWriter)
+	gw.markGet()
+	putUnlessPanic(&gzipWriterPool, gw)
+	func() {
+		defer func() {
+			if r := recover(); r != errDoublePut {
+				t.Errorf("recovered: %v, want: %v", r, errDoublePut)
+			}
+		}()
+		putUnlessPanic(&gzipWriterPool, gw)
+	}()
+}
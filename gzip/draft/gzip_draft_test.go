@@ -54,7 +54,10 @@ func GzipWithBytesBufferPool(data []byte) ([]byte, error) {
 		return nil, fmt.Errorf("failed to gzip Close: %v", err)
 	}
 
-	return buf.Bytes(), nil
+	// bufはPoolに戻して次の呼び出しで書き換えられるので、コピーして返す
+	res := make([]byte, buf.Len())
+	copy(res, buf.Bytes())
+	return res, nil
 }
 
 func GunzipWithBytesBufferPool(data []byte) ([]byte, error) {
@@ -74,7 +77,10 @@ func GunzipWithBytesBufferPool(data []byte) ([]byte, error) {
 	}
 	buf.Write(d)
 
-	return buf.Bytes(), nil
+	// bufはPoolに戻して次の呼び出しで書き換えられるので、コピーして返す
+	res := make([]byte, buf.Len())
+	copy(res, buf.Bytes())
+	return res, nil
 }
 
 // これうまくいかない
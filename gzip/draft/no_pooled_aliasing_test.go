@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Poolを使う関数の返り値は呼び出し側のもので、Poolのbufを参照してはいけない
+// 返り値がPoolのbufを参照していると、同じPoolで次にGet/Reset/Writeされた時に書き換わってしまう
+// 返り値を受け取った直後に同じPoolを使い、返り値が変わっていないことを確認する
+func TestNoPooledAliasing(t *testing.T) {
+	// Poolのbufを他の誰かが使ったのと同じことをする
+	// sync.PoolはPutした値を同じgoroutineの次のGetで返すので、返り値と同じbufが取れる
+	reusePool := func() {
+		buf := pool.Get().(*bytes.Buffer)
+		buf.Reset()
+		buf.Write(bytes.Repeat([]byte{0xff}, 1024))
+		pool.Put(buf)
+	}
+
+	tests := map[string]func() ([]byte, error){
+		"GzipWithBytesBufferPool": func() ([]byte, error) {
+			return GzipWithBytesBufferPool([]byte(data))
+		},
+		"GunzipWithBytesBufferPool": func() ([]byte, error) {
+			return GunzipWithBytesBufferPool(gzippedData)
+		},
+	}
+	for name, f := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, err := f()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := append([]byte(nil), res...)
+			first := res[0]
+
+			reusePool()
+
+			if res[0] != first {
+				t.Errorf("first byte changed after reusing the pool: got %#x, want %#x", res[0], first)
+			}
+			if !bytes.Equal(res, want) {
+				t.Error("result changed after reusing the pool")
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// GzipperWithSyncPoolが保持するgzipWriterの最大数
+const gzipperPoolSize = 64
+
+// DrainablePool はDrainで中身を捨てられるPool
+// sync.PoolはGCまで中身を保持し続けるので、メモリを早く解放したいときのためにchannelで実装している
+type DrainablePool struct {
+	New   func() interface{}
+	items chan interface{}
+}
+
+func NewDrainablePool(size int, newFunc func() interface{}) *DrainablePool {
+	return &DrainablePool{
+		New:   newFunc,
+		items: make(chan interface{}, size),
+	}
+}
+
+// Get はPoolに値があればそれを返し、なければNewで作った値を返す
+func (p *DrainablePool) Get() interface{} {
+	select {
+	case x := <-p.items:
+		return x
+	default:
+		return p.New()
+	}
+}
+
+// Put はPoolに値を戻す。Poolがいっぱいのときは捨てる
+func (p *DrainablePool) Put(x interface{}) {
+	select {
+	case p.items <- x:
+	default:
+	}
+}
+
+// Drain はPoolの中身を全て捨てて、捨てた数を返す
+func (p *DrainablePool) Drain() int {
+	n := 0
+	for {
+		select {
+		case <-p.items:
+			n++
+		default:
+			return n
+		}
+	}
+}
+
+func TestDrainablePool(t *testing.T) {
+	newCount := 0
+	p := NewDrainablePool(4, func() interface{} {
+		newCount++
+		return new(int)
+	})
+
+	// Poolを満たす
+	var xs []interface{}
+	for i := 0; i < 4; i++ {
+		xs = append(xs, p.Get())
+	}
+	for _, x := range xs {
+		p.Put(x)
+	}
+	if newCount != 4 {
+		t.Fatalf("newCount: %d, want: %d", newCount, 4)
+	}
+
+	// Drain前はPutした値が返ってくる
+	x := p.Get()
+	if newCount != 4 {
+		t.Errorf("newCount: %d, want: %d", newCount, 4)
+	}
+	p.Put(x)
+
+	if got := p.Drain(); got != 4 {
+		t.Errorf("Drain: %d, want: %d", got, 4)
+	}
+
+	// Drain後は新しく作った値が返ってくる
+	for i := 0; i < 4; i++ {
+		p.Get()
+	}
+	if newCount != 8 {
+		t.Errorf("newCount: %d, want: %d", newCount, 8)
+	}
+}
+
+func TestGzipperWithSyncPoolDrain(t *testing.T) {
+	g := NewGzipperWithSyncPool()
+	if _, err := g.Gzip([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	gw := g.GzipWriterPool.Load().Get().(*gzipWriter)
+	g.GzipWriterPool.Load().Put(gw)
+
+	if got := g.Drain(); got != 1 {
+		t.Errorf("Drain: %d, want: %d", got, 1)
+	}
+
+	if got := g.GzipWriterPool.Load().Get().(*gzipWriter); got == gw {
+		t.Errorf("got the drained gzipWriter after Drain")
+	}
+
+	// Drain後もGzipできる
+	res, err := g.Gzip([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Gunzip(bytes.NewBuffer(res))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Errorf("got: %s, want: %s", string(got), data)
+	}
+}
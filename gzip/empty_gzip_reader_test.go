@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"testing"
+)
+
+// EmptyGzipReader はデータが空のgzipを読み込んだ状態の*gzip.Readerを返す
+// gzip.Readerはgzip.NewReaderでしか作れず、NewReaderは作るときにheaderを読むので、
+// 空のbytes.Bufferを渡すとEOFになってReaderを作れない(gzip.goのmainを参照)
+// Poolに入れておいて後でResetで本当のデータに向けたい場合は、これで作っておく
+func EmptyGzipReader() (*gzip.Reader, error) {
+	// emptyGzipは書き換えないので、bytes.Readerで読むだけなら共有してよい
+	r, err := gzip.NewReader(bytes.NewReader(emptyGzip))
+	if err != nil {
+		return nil, fmt.Errorf("failed to gzip.NewReader for empty gzip: %w", err)
+	}
+	return r, nil
+}
+
+func TestEmptyGzipReader(t *testing.T) {
+	r, err := EmptyGzipReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gzip.NewReader(&bytes.Buffer{}); err == nil {
+		t.Error("gzip.NewReader on empty buffer unexpectedly succeeded")
+	}
+
+	// 作ったReaderは何度でもResetして別のデータを読める
+	for i := 0; i < 2; i++ {
+		want := fmt.Sprintf("%s-%d", data, i)
+		compressed, err := Gzip([]byte(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Reset(bytes.NewReader(compressed)); err != nil {
+			t.Fatal(err)
+		}
+		var got bytes.Buffer
+		if _, err := got.ReadFrom(r); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want {
+			t.Errorf("got: %s, want: %s", got.String(), want)
+		}
+	}
+}
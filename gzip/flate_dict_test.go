@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+)
+
+type flateWriter struct {
+	w   *flate.Writer
+	buf *bytes.Buffer
+}
+
+type flateReader struct {
+	r   io.ReadCloser
+	src *bytes.Reader
+	buf *bytes.Buffer
+}
+
+// FlateDictCompressor は共通の辞書を使ってflateで圧縮・展開する
+// 小さくて似たようなメッセージは単体だと圧縮が効かないが、よく出てくる文字列を辞書として渡すと圧縮率が大きく上がる
+// 辞書付きのWriter/Readerは作るのが重いのでPoolで使い回す
+// 展開する側も圧縮した時と同じ辞書を使う必要がある
+type FlateDictCompressor struct {
+	dict    []byte
+	writers sync.Pool
+	readers sync.Pool
+}
+
+// NewFlateDictCompressor はdictを辞書とするFlateDictCompressorを返す
+// dictは呼び出し後に書き換えられないようにコピーして持つ
+func NewFlateDictCompressor(dict []byte) *FlateDictCompressor {
+	c := &FlateDictCompressor{dict: append([]byte(nil), dict...)}
+	c.writers.New = func() interface{} {
+		buf := &bytes.Buffer{}
+		// DefaultCompressionなど低いlevelの高速なエンコーダは小さい入力で辞書を参照しないので、
+		// 辞書が効くBestCompressionを使う
+		// levelが正しければNewWriterDictはエラーを返さない
+		w, _ := flate.NewWriterDict(buf, flate.BestCompression, c.dict)
+		return &flateWriter{w: w, buf: buf}
+	}
+	c.readers.New = func() interface{} {
+		src := bytes.NewReader(nil)
+		return &flateReader{
+			r:   flate.NewReaderDict(src, c.dict),
+			src: src,
+			buf: &bytes.Buffer{},
+		}
+	}
+	return c
+}
+
+// Compress はdataを圧縮して返す。返り値はPoolのbufからコピーしたもの
+func (c *FlateDictCompressor) Compress(data []byte) ([]byte, error) {
+	fw := c.writers.Get().(*flateWriter)
+	defer c.writers.Put(fw)
+	fw.buf.Reset()
+	// ResetはNewWriterDictで作った時の辞書をそのまま使う
+	fw.w.Reset(fw.buf)
+
+	if _, err := fw.w.Write(data); err != nil {
+		return nil, fmt.Errorf("%w: failed to flate Write: %w", ErrCompress, err)
+	}
+	if err := fw.w.Close(); err != nil {
+		return nil, fmt.Errorf("%w: failed to flate Close: %w", ErrCompress, err)
+	}
+
+	res := make([]byte, fw.buf.Len())
+	copy(res, fw.buf.Bytes())
+	return res, nil
+}
+
+// Decompress はCompressで圧縮したdataを展開して返す。返り値はPoolのbufからコピーしたもの
+func (c *FlateDictCompressor) Decompress(data []byte) ([]byte, error) {
+	fr := c.readers.Get().(*flateReader)
+	defer c.readers.Put(fr)
+	defer fr.src.Reset(nil)
+	fr.buf.Reset()
+	fr.src.Reset(data)
+	// flate.ReaderのResetは辞書も毎回渡す必要がある
+	if err := fr.r.(flate.Resetter).Reset(fr.src, c.dict); err != nil {
+		return nil, fmt.Errorf("%w: failed to Reset flate Reader: %w", ErrDecompress, err)
+	}
+
+	if _, err := io.Copy(fr.buf, fr.r); err != nil {
+		return nil, fmt.Errorf("%w: failed to io.Copy: %w", ErrDecompress, err)
+	}
+
+	res := make([]byte, fr.buf.Len())
+	copy(res, fr.buf.Bytes())
+	return res, nil
+}
+
+func TestFlateDictCompressor(t *testing.T) {
+	var messages [][]byte
+	for i := 0; i < 20; i++ {
+		messages = append(messages, []byte(fmt.Sprintf(
+			`{"id":%d,"name":"user%d","items":["knife","shield","herbs"],"status":"active"}`, i, i)))
+	}
+	dict := []byte(`{"id":,"name":"user","items":["knife","shield","herbs"],"status":"active"}`)
+
+	withDict := NewFlateDictCompressor(dict)
+	withoutDict := NewFlateDictCompressor(nil)
+
+	var sizeWithDict, sizeWithoutDict int
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		sizeWithDict, sizeWithoutDict = 0, 0
+		for _, m := range messages {
+			for _, c := range []*FlateDictCompressor{withDict, withoutDict} {
+				compressed, err := c.Compress(m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := c.Decompress(compressed)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, m) {
+					t.Errorf("got: %s, want: %s", got, m)
+				}
+				if c == withDict {
+					sizeWithDict += len(compressed)
+				} else {
+					sizeWithoutDict += len(compressed)
+				}
+			}
+		}
+	}
+	t.Logf("total compressed size: with dict %d, without dict %d", sizeWithDict, sizeWithoutDict)
+	if sizeWithDict*2 > sizeWithoutDict {
+		t.Errorf("dictionary did not improve ratio enough: with dict %d, without dict %d", sizeWithDict, sizeWithoutDict)
+	}
+
+	// 違う辞書では正しく展開できない
+	compressed, err := withDict.Compress(messages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := withoutDict.Decompress(compressed); err == nil && bytes.Equal(got, messages[0]) {
+		t.Error("decompressed without the dictionary")
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+)
+
+// 1つのframeの圧縮後の最大の長さ。壊れた長さを読んだときに巨大なbufを確保しないようにする
+const maxFrameSize = 64 << 20
+
+var (
+	ErrFrameTooLarge     = errors.New("frame is too large")
+	errFrameReaderClosed = errors.New("FrameReader is already closed")
+)
+
+// AppendUvarint はxをvarint(protocol buffersと同じ形式)にしてdstに追加する
+// binary.AppendUvarintと同じもので、読む側はbinary.ReadUvarintで読める
+func AppendUvarint(dst []byte, x uint64) []byte {
+	return binary.AppendUvarint(dst, x)
+}
+
+// frameScratchPoolに戻すbufの最大の容量
+// 大きなframeを一度だけ読んだときに、maxFrameSizeまで育ったbufがPoolに残り続けないようにする
+const frameScratchMaxCap = 1 << 20
+
+// frameScratchPool はFrameWriterとFrameReaderがframeを組み立てたり読み込んだりするときに使うbuf
+var frameScratchPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 4096)
+		return &b
+	},
+}
+
+// putFrameScratch はspをframeScratchPoolに戻す。capがframeScratchMaxCapより大きければ捨てる
+func putFrameScratch(sp *[]byte) {
+	if cap(*sp) > frameScratchMaxCap {
+		return
+	}
+	frameScratchPool.Put(sp)
+}
+
+// FrameWriter はデータをgzipして、圧縮後の長さをvarintで前に付けたframeとしてwに書き込む
+// frameを続けて書くと、区切り文字なしで1つずつ読み出せるストリームになる
+type FrameWriter struct {
+	w io.Writer
+}
+
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	return &FrameWriter{w: w}
+}
+
+// WriteFrame はdataをgzipして1つのframeとして書き込む
+// 長さとgzipのデータはPoolのbufでつなげてから1回のWriteで書き込むので、途中で失敗しても長さだけが書かれることはない
+func (f *FrameWriter) WriteFrame(data []byte) error {
+	gw := gzipWriterPool.Get().(*gzipWriter)
+	gw.markGet()
+	defer putUnlessPanic(&gzipWriterPool, gw)
+	gw.buf.Reset()
+	gw.w.Reset(gw.buf)
+	if _, err := gw.w.Write(data); err != nil {
+		return fmt.Errorf("%w: failed to gzip Write: %w", ErrCompress, err)
+	}
+	if err := gw.w.Close(); err != nil {
+		return fmt.Errorf("%w: failed to gzip Close: %w", ErrCompress, err)
+	}
+
+	sp := frameScratchPool.Get().(*[]byte)
+	defer putFrameScratch(sp)
+	*sp = AppendUvarint((*sp)[:0], uint64(gw.buf.Len()))
+	*sp = append(*sp, gw.buf.Bytes()...)
+	if _, err := f.w.Write(*sp); err != nil {
+		return fmt.Errorf("failed to write frame: %w", err)
+	}
+	return nil
+}
+
+// FrameReader はFrameWriterが書いたframeを1つずつ読んで展開する
+// 読み終わったら必ずCloseしてPoolのbufio.Readerを戻すこと
+type FrameReader struct {
+	br *bufio.Reader
+}
+
+func NewFrameReader(r io.Reader) *FrameReader {
+	br := bufioReaderPool.Get().(*bufio.Reader)
+	br.Reset(r)
+	return &FrameReader{br: br}
+}
+
+// ReadFrame は次のframeを展開して返す。返り値はPoolのbufからコピーしたもの
+// frameの境目で入力が終わったらio.EOF、frameの途中で終わったらio.ErrUnexpectedEOFを返す
+func (f *FrameReader) ReadFrame() ([]byte, error) {
+	if f.br == nil {
+		return nil, errFrameReaderClosed
+	}
+	size, err := binary.ReadUvarint(f.br)
+	if err != nil {
+		// ReadUvarintは1バイトも読めなかったときだけio.EOFを返す
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("%w: failed to read frame size: %w", ErrRead, err)
+	}
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, size)
+	}
+
+	sp := frameScratchPool.Get().(*[]byte)
+	defer putFrameScratch(sp)
+	if cap(*sp) < int(size) {
+		*sp = make([]byte, size)
+	}
+	*sp = (*sp)[:size]
+	if _, err := io.ReadFull(f.br, *sp); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("%w: failed to read frame: %w", ErrRead, err)
+	}
+	return GunzipBytes(*sp)
+}
+
+// Close はbufio.ReaderをPoolに戻す。2回目以降のCloseは何もしない
+func (f *FrameReader) Close() error {
+	if f.br == nil {
+		return nil
+	}
+	f.br.Reset(nil) // Poolに戻した後に呼び出し元のReaderを参照し続けないようにする
+	bufioReaderPool.Put(f.br)
+	f.br = nil
+	return nil
+}
+
+func TestFrameWriterReader(t *testing.T) {
+	frames := [][]byte{
+		[]byte("first"),
+		{},
+		[]byte(data),
+		// 圧縮後の長さが1バイトのvarintに収まらない大きさ
+		sizedInput(64 * 1024),
+		[]byte("last"),
+	}
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		var stream bytes.Buffer
+		w := NewFrameWriter(&stream)
+		for _, f := range frames {
+			if err := w.WriteFrame(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		r := NewFrameReader(&stream)
+		for j, want := range frames {
+			got, err := r.ReadFrame()
+			if err != nil {
+				t.Fatalf("frame %d: %v", j, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("frame %d: got %d bytes, want %d bytes", j, len(got), len(want))
+			}
+		}
+		if _, err := r.ReadFrame(); err != io.EOF {
+			t.Errorf("after last frame: got %v, want %v", err, io.EOF)
+		}
+		r.Close()
+		if _, err := r.ReadFrame(); !errors.Is(err, errFrameReaderClosed) {
+			t.Errorf("after Close: got %v, want %v", err, errFrameReaderClosed)
+		}
+	}
+}
+
+func TestFrameReaderErrors(t *testing.T) {
+	var stream bytes.Buffer
+	if err := NewFrameWriter(&stream).WriteFrame([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	whole := stream.Bytes()
+
+	tests := map[string]struct {
+		in   []byte
+		want error
+	}{
+		"truncated_body": {in: whole[:len(whole)-3], want: io.ErrUnexpectedEOF},
+		"truncated_size": {in: []byte{0x80}, want: io.ErrUnexpectedEOF},
+		"too_large":      {in: AppendUvarint(nil, maxFrameSize+1), want: ErrFrameTooLarge},
+		"not_gzip":       {in: append(AppendUvarint(nil, 8), "not gzip"...), want: ErrDecompress},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := NewFrameReader(bytes.NewReader(tc.in))
+			defer r.Close()
+			if _, err := r.ReadFrame(); !errors.Is(err, tc.want) {
+				t.Errorf("got: %v, want: %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestFrameScratchMaxCap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	// 先にGetしてPoolのprivateを空にしておき、putFrameScratchで戻したbufが次のGetで返るようにする
+	frameScratchPool.Get()
+
+	large := make([]byte, 0, frameScratchMaxCap+1)
+	putFrameScratch(&large)
+	if got := frameScratchPool.Get().(*[]byte); cap(*got) > frameScratchMaxCap {
+		t.Errorf("buf with cap %d was put back to the pool", cap(*got))
+	}
+
+	small := make([]byte, 0, 8192)
+	putFrameScratch(&small)
+	if got := frameScratchPool.Get().(*[]byte); got != &small {
+		t.Errorf("got buf with cap %d, want the small buf back", cap(*got))
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// gcStats はworkloadの前後のruntime.MemStatsの差分
+type gcStats struct {
+	NumGC        uint32
+	PauseTotalNs uint64
+	TotalAlloc   uint64
+	Mallocs      uint64
+}
+
+func (s gcStats) String() string {
+	return fmt.Sprintf("NumGC: %d, PauseTotal: %dns, TotalAlloc: %dB, Mallocs: %d",
+		s.NumGC, s.PauseTotalNs, s.TotalAlloc, s.Mallocs)
+}
+
+// measureGC はfをruns回実行して、その間に起きたGCの回数と停止時間を返す
+// allocs/opはアロケーションの回数しか分からないが、sync.Poolの効果はGCの負荷が減ることなので、
+// GCの回数と停止時間も合わせて確認する
+func measureGC(runs int, f func()) gcStats {
+	// 前の処理のゴミが結果に混ざらないように、先にGCしておく
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < runs; i++ {
+		f()
+	}
+	runtime.ReadMemStats(&after)
+	return gcStats{
+		NumGC:        after.NumGC - before.NumGC,
+		PauseTotalNs: after.PauseTotalNs - before.PauseTotalNs,
+		TotalAlloc:   after.TotalAlloc - before.TotalAlloc,
+		Mallocs:      after.Mallocs - before.Mallocs,
+	}
+}
+
+// $go test -run GCStats -v
+// Gzip:                   NumGC: 7997, PauseTotal: 54032410ns, TotalAlloc: 21530880032B, Mallocs: 360001
+// GzipWithGzipWriterPool: NumGC: 0, PauseTotal: 0ns, TotalAlloc: 1076752B, Mallocs: 22
+func TestGzipGCStats(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip GC stats in short mode")
+	}
+	const runs = 20000
+	in := []byte(data)
+
+	withoutPool := measureGC(runs, func() {
+		r, _ := Gzip(in)
+		Result = r
+	})
+	withPool := measureGC(runs, func() {
+		r, _ := GzipWithGzipWriterPool(in)
+		Result = r
+	})
+
+	fmt.Printf("Gzip:                   %s\n", withoutPool)
+	fmt.Printf("GzipWithGzipWriterPool: %s\n", withPool)
+}
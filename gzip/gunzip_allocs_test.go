@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// gunzipWithGzipReaderPoolBefore はgzipReaderにbrを持たせる前のGunzipWithGzipReaderPool
+// gr.srcはio.ByteReaderではないので、gzip.Reader.Resetが毎回bufio.NewReaderで4KB確保していた。ベンチマークの比較用
+func gunzipWithGzipReaderPoolBefore(data io.Reader) ([]byte, error) {
+	gr := gzipReaderPool.Get().(*gzipReader)
+	if gr.err != nil {
+		return nil, gr.err
+	}
+	defer gzipReaderPool.Put(gr)
+	defer gr.src.reset(nil)
+	defer gr.r.Close()
+	gr.buf.Reset()
+	gr.src.reset(data)
+	if err := gr.r.Reset(&gr.src); err != nil {
+		return nil, gr.src.wrapErr("failed to Reset gzip Reader", err)
+	}
+
+	if _, err := io.Copy(gr.buf, gr.r); err != nil {
+		return nil, gr.src.wrapErr("failed to io.Copy", err)
+	}
+	return gr.buf.Bytes(), nil
+}
+
+func TestGunzipWithGzipReaderPoolAllocs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	var rd bytes.Reader
+	allocs := testing.AllocsPerRun(100, func() {
+		rd.Reset(gzippedData)
+		got, err := GunzipWithGzipReaderPool(&rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Fatalf("got: %s, want: %s", got, data)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("allocs: %v, want: 0", allocs)
+	}
+}
+
+// BenchmarkGunzipWithGzipReaderPoolなどが使うgzippedDataStreamはbytes.Bufferなので、
+// 最初の1回で読み切ってしまい、2回目以降はResetのエラーになる時間を測っている
+// ここでは毎回bytes.ReaderをResetして、展開に成功する場合を測る
+func benchmarkGunzipReader(b *testing.B, gunzip func(io.Reader) ([]byte, error)) {
+	var rd bytes.Reader
+	b.ReportAllocs()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		rd.Reset(gzippedData)
+		var err error
+		r, err = gunzip(&rd)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	Result = r
+}
+
+func BenchmarkGunzipWithGzipReaderPoolBefore(b *testing.B) {
+	benchmarkGunzipReader(b, gunzipWithGzipReaderPoolBefore)
+}
+
+func BenchmarkGunzipWithGzipReaderPoolAfter(b *testing.B) {
+	benchmarkGunzipReader(b, GunzipWithGzipReaderPool)
+}
+
+// go test -run XX -bench 'GunzipWithGzipReaderPool(Before|After)' .
+// BenchmarkGunzipWithGzipReaderPoolBefore 	  245684	      4955 ns/op	    4192 B/op	       2 allocs/op
+// BenchmarkGunzipWithGzipReaderPoolAfter  	  312778	      3885 ns/op	       0 B/op	       0 allocs/op
+// 2 allocsはbufio.NewReaderのReaderと4KBのbuf
+// io.Copyの書き込み先のbytes.Bufferはio.ReaderFromなので、io.Copyはコピー用のbufを作らない
+// io.CopyBufferにPoolのbufを渡しても使われないので、io.Copyのままにしている
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var errUnsupportedGunzipSource = errors.New("GunzipAny: src must be []byte or io.Reader")
+
+// gunzipCore はpoolのgzipReaderでdataかrを展開してgr.bufに書き込み、そのgzipReaderを返す
+// rがnilならdataを展開する。dataはgr.in(bytes.Reader)を通すので、gzip.Reader.Resetがbufio.Readerを作らない
+// rのときはgr.srcを通して、rの読み込みエラー(ErrRead)と展開のエラー(ErrDecompress)を区別する
+// さらにgr.brを通してio.ByteReaderにするので、こちらもbufio.Readerを作らない
+// 返したgzipReaderはgr.bufを使い終わってからputGzipReaderでpoolに戻すこと。エラーのときは戻してある
+func gunzipCore(pool *sync.Pool, data []byte, r io.Reader, multistream bool) (*gzipReader, error) {
+	gr := pool.Get().(*gzipReader)
+	if gr.err != nil {
+		return nil, fmt.Errorf("%w: failed to Get gzipReaderPool: %w", ErrDecompress, gr.err)
+	}
+	gr.buf.Reset()
+
+	wrapErr := func(msg string, err error) error {
+		return fmt.Errorf("%w: %s: %w", ErrDecompress, msg, err)
+	}
+	var src io.Reader = &gr.in
+	if r != nil {
+		gr.src.reset(r)
+		if gr.br == nil {
+			gr.br = bufio.NewReader(&gr.src)
+		} else {
+			gr.br.Reset(&gr.src)
+		}
+		src = gr.br
+		wrapErr = gr.src.wrapErr
+	} else {
+		gr.in.Reset(data)
+	}
+
+	// wrapErrはgr.srcの記録したエラーを見るので、putGzipReaderでgr.srcを空にする前に呼ぶ
+	if err := gr.r.Reset(src); err != nil {
+		err = wrapErr("failed to Reset gzip Reader", err)
+		putGzipReader(pool, gr)
+		return nil, err
+	}
+	// Resetで毎回trueに戻るので、Poolに戻した後の呼び出しには影響しない
+	gr.r.Multistream(multistream)
+
+	if _, err := io.Copy(gr.buf, gr.r); err != nil {
+		err = wrapErr("failed to io.Copy", err)
+		putGzipReader(pool, gr)
+		return nil, err
+	}
+	return gr, nil
+}
+
+// putGzipReader はgunzipCoreで使ったgzipReaderをpoolに戻す
+// Poolに戻した後に呼び出し元のdataやrを参照し続けないようにする
+func putGzipReader(pool *sync.Pool, gr *gzipReader) {
+	gr.r.Close()
+	gr.in.Reset(nil)
+	gr.src.reset(nil)
+	if gr.br != nil {
+		gr.br.Reset(nil)
+	}
+	pool.Put(gr)
+}
+
+// gunzipCopy はgunzipCoreで展開した結果をコピーして返す
+func gunzipCopy(pool *sync.Pool, data []byte, r io.Reader, multistream bool) ([]byte, error) {
+	gr, err := gunzipCore(pool, data, r, multistream)
+	if err != nil {
+		return nil, err
+	}
+	defer putGzipReader(pool, gr)
+
+	res := make([]byte, gr.buf.Len())
+	copy(res, gr.buf.Bytes())
+	return res, nil
+}
+
+// GunzipBytes はdataを展開する。返り値はPoolのbufからコピーしたもの
+func GunzipBytes(data []byte) ([]byte, error) {
+	return gunzipCopy(&gzipReaderPool, data, nil, true)
+}
+
+// GunzipReader はrから読みながら展開する。返り値はPoolのbufからコピーしたもの
+func GunzipReader(r io.Reader) ([]byte, error) {
+	if r == nil {
+		return nil, fmt.Errorf("%w: nil io.Reader", ErrDecompress)
+	}
+	return gunzipCopy(&gzipReaderPool, nil, r, true)
+}
+
+// GunzipAny はsrcが[]byteならGunzipBytes、io.ReaderならGunzipReaderで展開する
+// 入力が[]byteとio.Readerのどちらで来るか決まっていない呼び出し元のためのもの
+func GunzipAny(src interface{}) ([]byte, error) {
+	switch s := src.(type) {
+	case []byte:
+		return GunzipBytes(s)
+	case io.Reader:
+		return GunzipReader(s)
+	default:
+		return nil, fmt.Errorf("%w: got %T", errUnsupportedGunzipSource, src)
+	}
+}
+
+func TestGunzipAny(t *testing.T) {
+	tests := map[string]struct {
+		src  func() interface{} // io.Readerは読むと空になるので毎回作る
+		want string
+	}{
+		"bytes":       {src: func() interface{} { return gzippedData }, want: data},
+		"reader":      {src: func() interface{} { return bytes.NewReader(gzippedData) }, want: data},
+		"multistream": {src: func() interface{} { return append(mustGzip(t, "hello "), mustGzip(t, "world")...) }, want: "hello world"},
+	}
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		for name, tc := range tests {
+			t.Run(name, func(t *testing.T) {
+				got, err := GunzipAny(tc.src())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != tc.want {
+					t.Errorf("got: %s, want: %s", got, tc.want)
+				}
+			})
+		}
+	}
+
+	// GunzipBytesとGunzipReaderの返り値はPoolのbufと共有していない
+	first, err := GunzipBytes(mustGzip(t, "first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GunzipReader(bytes.NewReader(mustGzip(t, "second"))); err != nil {
+		t.Fatal(err)
+	}
+	if string(first) != "first" {
+		t.Errorf("result was overwritten: %s", first)
+	}
+}
+
+func TestGunzipAnyErrors(t *testing.T) {
+	if _, err := GunzipAny("not bytes"); !errors.Is(err, errUnsupportedGunzipSource) {
+		t.Errorf("string: got %v, want %v", err, errUnsupportedGunzipSource)
+	}
+	if _, err := GunzipAny(nil); !errors.Is(err, errUnsupportedGunzipSource) {
+		t.Errorf("nil: got %v, want %v", err, errUnsupportedGunzipSource)
+	}
+	if _, err := GunzipBytes([]byte("not gzip")); !errors.Is(err, ErrDecompress) {
+		t.Errorf("bytes: got %v, want %v", err, ErrDecompress)
+	}
+	if _, err := GunzipReader(strings.NewReader("not gzip")); !errors.Is(err, ErrDecompress) {
+		t.Errorf("reader: got %v, want %v", err, ErrDecompress)
+	}
+	// 読み込みのエラーはErrReadになる
+	r := &brokenReader{r: bytes.NewReader(gzippedData), n: 20}
+	if _, err := GunzipReader(r); !errors.Is(err, ErrRead) || !errors.Is(err, errBrokenReader) {
+		t.Errorf("broken reader: got %v, want %v wrapping %v", err, ErrRead, errBrokenReader)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// GunzipWithProgressがonProgressを呼ぶ間隔(展開後のバイト数)
+const progressInterval = 64 * 1024
+
+var progressBufPool = NewBufferPool()
+
+// progressWriter はwに書き込んだバイト数を数えて、intervalごとにonProgressを呼ぶ
+type progressWriter struct {
+	w          io.Writer
+	onProgress func(bytesWritten int64)
+	n          int64
+	reported   int64
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.n += int64(n)
+	if p.n-p.reported >= progressInterval {
+		p.report()
+	}
+	return n, err
+}
+
+func (p *progressWriter) report() {
+	p.reported = p.n
+	p.onProgress(p.n)
+}
+
+// GunzipWithProgress はsrcを展開して、展開したバイト数をonProgressで知らせる
+// onProgressは64KB展開するごとと、最後に全体のバイト数で呼ばれる
+// 展開は呼び出したgoroutineで行うので、この関数が返った後にonProgressが呼ばれることはない
+// 返り値はPoolのbufからコピーしたもの
+func GunzipWithProgress(src []byte, onProgress func(bytesWritten int64)) ([]byte, error) {
+	buf := progressBufPool.Get().(*bytes.Buffer)
+	defer progressBufPool.Put(buf)
+	buf.Reset()
+
+	pw := &progressWriter{w: buf, onProgress: onProgress}
+	if _, err := GunzipToWriter(pw, src); err != nil {
+		return nil, err
+	}
+	if pw.n != pw.reported || pw.n == 0 {
+		pw.report()
+	}
+
+	res := make([]byte, buf.Len())
+	copy(res, buf.Bytes())
+	return res, nil
+}
+
+func TestGunzipWithProgress(t *testing.T) {
+	large := sizedInput(1 << 20)
+	compressedLarge, err := Gzip(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressedEmpty, err := Gzip(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		src  []byte
+		want []byte
+	}{
+		"large": {src: compressedLarge, want: large},
+		"small": {src: gzippedData, want: []byte(data)},
+		"empty": {src: compressedEmpty, want: []byte{}},
+	}
+	for i := 0; i < 2; i++ {
+		for name, tc := range tests {
+			t.Run(name, func(t *testing.T) {
+				var reports []int64
+				got, err := GunzipWithProgress(tc.src, func(n int64) {
+					reports = append(reports, n)
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, tc.want) {
+					t.Errorf("got %d bytes, want %d bytes", len(got), len(tc.want))
+				}
+				if len(reports) == 0 {
+					t.Fatal("onProgress was not called")
+				}
+				if last := reports[len(reports)-1]; last != int64(len(got)) {
+					t.Errorf("last report: %d, want: %d", last, len(got))
+				}
+				for j := 1; j < len(reports); j++ {
+					if reports[j] <= reports[j-1] {
+						t.Errorf("reports are not increasing: %v", reports)
+						break
+					}
+				}
+				// 1MBなら64KBごとに16回前後呼ばれる
+				if len(got) >= 1<<20 && len(reports) < (1<<20)/progressInterval {
+					t.Errorf("got %d reports, want at least %d", len(reports), (1<<20)/progressInterval)
+				}
+			})
+		}
+	}
+
+	called := false
+	if _, err := GunzipWithProgress([]byte("not gzip"), func(int64) { called = true }); err == nil {
+		t.Error("want error for non-gzip input")
+	}
+	if called {
+		t.Error("onProgress was called for a failed decompression")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+var errGunzipReadCloserClosed = errors.New("gunzipReadCloser is already closed")
+
+type gunzipReadCloser struct {
+	gr *gzipReader
+}
+
+func (g *gunzipReadCloser) Read(p []byte) (int, error) {
+	if g.gr == nil {
+		return 0, errGunzipReadCloserClosed
+	}
+	return g.gr.r.Read(p)
+}
+
+// Close はgzipReaderをPoolに戻す。2回目以降のCloseは何もしない
+func (g *gunzipReadCloser) Close() error {
+	if g.gr == nil {
+		return nil
+	}
+	gr := g.gr
+	g.gr = nil
+	err := gr.r.Close()
+	putGzipReader(&gzipReaderPool, gr)
+	return err
+}
+
+// NewGunzipReadCloser はsrcを展開しながら読むReaderを返す
+// httpのレスポンスやファイルをReadAllせずにそのまま展開して読める
+// 読み終わったら必ずCloseして、PoolのgzipReaderを戻すこと
+func NewGunzipReadCloser(src io.Reader) (io.ReadCloser, error) {
+	gr := gzipReaderPool.Get().(*gzipReader)
+	if gr.err != nil {
+		return nil, fmt.Errorf("%w: failed to Get gzipReaderPool: %w", ErrDecompress, gr.err)
+	}
+	gr.src.reset(src)
+	if err := gr.r.Reset(&gr.src); err != nil {
+		// wrapErrはgr.srcの記録したエラーを見るので、putGzipReaderでgr.srcを空にする前に呼ぶ
+		// 次に使う時にResetしなおすので、失敗したものもPoolに戻してよい
+		err = gr.src.wrapErr("failed to Reset gzip Reader", err)
+		putGzipReader(&gzipReaderPool, gr)
+		return nil, err
+	}
+	return &gunzipReadCloser{gr: gr}, nil
+}
+
+func TestNewGunzipReadCloser(t *testing.T) {
+	compressed, err := Gzip([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		rc, err := NewGunzipReadCloser(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 少しずつ読む
+		var got []byte
+		chunk := make([]byte, 7)
+		for {
+			n, err := rc.Read(chunk)
+			got = append(got, chunk[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if string(got) != data {
+			t.Errorf("got: %s, want: %s", string(got), data)
+		}
+
+		if err := rc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := rc.Close(); err != nil {
+			t.Errorf("second Close: %v", err)
+		}
+		if _, err := rc.Read(chunk); !errors.Is(err, errGunzipReadCloserClosed) {
+			t.Errorf("Read after Close: %v, want: %v", err, errGunzipReadCloserClosed)
+		}
+	}
+
+	t.Run("not_gzip", func(t *testing.T) {
+		if _, err := NewGunzipReadCloser(bytes.NewReader([]byte("plain text"))); !errors.Is(err, ErrDecompress) {
+			t.Errorf("got: %v, want: %v", err, ErrDecompress)
+		}
+		// headerを読んでいる途中の読み込みエラー
+		if _, err := NewGunzipReadCloser(&brokenReader{r: bytes.NewReader(compressed), n: 5}); !errors.Is(err, ErrRead) || !errors.Is(err, errBrokenReader) {
+			t.Errorf("got: %v, want: %v and %v", err, ErrRead, errBrokenReader)
+		}
+		// 失敗した後もPoolのgzipReaderは使える
+		got, err := GunzipWithGzipReaderPool(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Errorf("got: %s, want: %s", string(got), data)
+		}
+	})
+}
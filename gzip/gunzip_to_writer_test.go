@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// GunzipToWriter はsrcを展開しながらdstに直接書き込み、書き込んだバイト数を返す
+// GunzipWithGzipReaderPoolのように一度Poolのbufに展開してから呼び出し側でコピーする必要がないので、
+// 展開結果の置き場所を呼び出し側が用意できる場合はこちらを使う
+func GunzipToWriter(dst io.Writer, src []byte) (int64, error) {
+	gr := gzipReaderPool.Get().(*gzipReader)
+	if gr.err != nil {
+		return 0, fmt.Errorf("%w: failed to Get gzipReaderPool: %w", ErrDecompress, gr.err)
+	}
+	defer gzipReaderPool.Put(gr)
+	// Poolに戻した後に呼び出し元のsrcを参照し続けないようにする
+	defer gr.in.Reset(nil)
+	defer gr.r.Close()
+	gr.in.Reset(src)
+	// gzip.Reader.Resetはio.ByteReaderでないReaderを毎回bufio.NewReaderで包むので4KB確保してしまう
+	// bytes.Readerはio.ByteReaderなので直接渡す
+	// メモリ上のsrcからの読み込みは失敗しないので、errRecordingReaderで読み込みエラーを区別する必要もない
+	if err := gr.r.Reset(&gr.in); err != nil {
+		return 0, fmt.Errorf("%w: failed to Reset gzip Reader: %w", ErrDecompress, err)
+	}
+
+	n, err := copyWithPool(dst, gr.r)
+	if err != nil {
+		return n, fmt.Errorf("%w: failed to io.Copy: %w", ErrDecompress, err)
+	}
+	return n, nil
+}
+
+func TestGunzipToWriter(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		var dst bytes.Buffer
+		n, err := GunzipToWriter(&dst, gzippedData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(len(data)) {
+			t.Errorf("n: %d, want: %d", n, len(data))
+		}
+		if dst.String() != data {
+			t.Errorf("got: %s, want: %s", dst.String(), data)
+		}
+	}
+
+	var dst bytes.Buffer
+	if _, err := GunzipToWriter(&dst, []byte("not gzip")); err == nil {
+		t.Error("want error for non-gzip input")
+	}
+}
+
+// GunzipWithGzipReaderPoolの展開結果をdstにコピーする場合と比べる
+// 両方とも入力は毎回新しいReaderで、書き込み先のdstは使い回す
+// GunzipWithGzipReaderPoolはgzip.Reader.Resetの中でbufio.Readerを確保する分が残る
+// BenchmarkGunzipWithGzipReaderPoolToBuffer         228480              4735 ns/op            4240 B/op          3 allocs/op
+// BenchmarkGunzipToWriter                           346010              3558 ns/op               0 B/op          0 allocs/op
+func BenchmarkGunzipWithGzipReaderPoolToBuffer(b *testing.B) {
+	b.ReportAllocs()
+	var dst bytes.Buffer
+	for n := 0; n < b.N; n++ {
+		dst.Reset()
+		r, _ := GunzipWithGzipReaderPool(bytes.NewReader(gzippedData))
+		dst.Write(r)
+	}
+	Result = dst.Bytes()
+}
+
+func BenchmarkGunzipToWriter(b *testing.B) {
+	b.ReportAllocs()
+	var dst bytes.Buffer
+	for n := 0; n < b.N; n++ {
+		dst.Reset()
+		GunzipToWriter(&dst, gzippedData)
+	}
+	Result = dst.Bytes()
+}
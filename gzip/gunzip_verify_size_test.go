@@ -0,0 +1,107 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var ErrSizeMismatch = errors.New("gzip ISIZE trailer does not match the decompressed size")
+
+// GunzipVerifySize はdataを展開して、gzipのトレーラーのISIZE(展開後のサイズを2^32で割った余り)と
+// 展開した長さが一致するか確認する。一致しなければErrSizeMismatchを返す
+// gzip.ReaderもISIZEを確認するが、CRCの不一致と同じgzip.ErrChecksumになって区別できないので、
+// どちらが原因かが分かるようにする
+// 最初のmemberだけを読み、後ろに続くデータがあればエラーにする。返り値はPoolのbufからコピーしたもの
+func GunzipVerifySize(data []byte) ([]byte, error) {
+	gr := gzipReaderPool.Get().(*gzipReader)
+	if gr.err != nil {
+		return nil, fmt.Errorf("%w: failed to Get gzipReaderPool: %w", ErrDecompress, gr.err)
+	}
+	defer gzipReaderPool.Put(gr)
+	defer gr.in.Reset(nil)
+	defer gr.r.Close()
+	gr.buf.Reset()
+	gr.in.Reset(data)
+	if err := gr.r.Reset(&gr.in); err != nil {
+		return nil, fmt.Errorf("%w: failed to Reset gzip Reader: %w", ErrDecompress, err)
+	}
+	// ResetでMultistreamはtrueに戻るので、Poolに戻した後の呼び出しには影響しない
+	gr.r.Multistream(false)
+
+	_, err := gr.buf.ReadFrom(gr.r)
+	if err != nil && !errors.Is(err, gzip.ErrChecksum) {
+		return nil, fmt.Errorf("%w: failed to read gzip Reader: %w", ErrDecompress, err)
+	}
+
+	// bytes.Readerはio.ByteReaderなのでgzip.Readerは余分に読み込まない
+	// 残りの長さから、読み終わったmemberのトレーラーの位置が分かる
+	end := len(data) - gr.in.Len()
+	isize := binary.LittleEndian.Uint32(data[end-4 : end])
+	if got := uint32(gr.buf.Len()); got != isize {
+		return nil, fmt.Errorf("%w: ISIZE %d, decompressed %d bytes", ErrSizeMismatch, isize, gr.buf.Len())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read gzip Reader: %w", ErrDecompress, err)
+	}
+	if gr.in.Len() > 0 {
+		return nil, fmt.Errorf("%w: %d bytes after the gzip member", ErrDecompress, gr.in.Len())
+	}
+
+	res := make([]byte, gr.buf.Len())
+	copy(res, gr.buf.Bytes())
+	return res, nil
+}
+
+func TestGunzipVerifySize(t *testing.T) {
+	compressed, err := Gzip([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		got, err := GunzipVerifySize(compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Errorf("got: %s, want: %s", got, data)
+		}
+	}
+
+	t.Run("tampered_isize", func(t *testing.T) {
+		tampered := append([]byte{}, compressed...)
+		n := len(tampered)
+		binary.LittleEndian.PutUint32(tampered[n-4:], uint32(len(data)+1))
+		if _, err := GunzipVerifySize(tampered); !errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("got: %v, want: %v", err, ErrSizeMismatch)
+		}
+	})
+	t.Run("tampered_crc", func(t *testing.T) {
+		// CRCが壊れているときはサイズの不一致ではない
+		tampered := append([]byte{}, compressed...)
+		tampered[len(tampered)-8] ^= 0xff
+		_, err := GunzipVerifySize(tampered)
+		if !errors.Is(err, gzip.ErrChecksum) || errors.Is(err, ErrSizeMismatch) {
+			t.Errorf("got: %v, want: %v", err, gzip.ErrChecksum)
+		}
+	})
+	t.Run("trailing_data", func(t *testing.T) {
+		if _, err := GunzipVerifySize(append(append([]byte{}, compressed...), compressed...)); !errors.Is(err, ErrDecompress) {
+			t.Errorf("got: %v, want: %v", err, ErrDecompress)
+		}
+	})
+
+	// エラーの後もPoolのgzipReaderが正しく使える
+	got, err := GunzipVerifySize(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Errorf("got: %s, want: %s", got, data)
+	}
+}
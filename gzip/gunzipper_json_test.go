@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// GunzipJSON はgzipされたJSONのdataを展開しながら、PoolのDecoderでそのままoutにデコードする
+// 展開した[]byteを作らないので、Gunzipしてからjson.Unmarshalするよりメモリを使わない
+// outは前の値を消してからデコードするが、Itemsの配列は容量が足りていれば使い回す
+// 入力にitemsがないときやnullのときは、outが新しいかどうかに関わらずItemsを空のsliceにする
+func (g *GunzipperWithSyncPool) GunzipJSON(data []byte, out *JsonData) error {
+	gr := g.GzipReaderPool.Get().(*gzipReader)
+	if gr.err != nil {
+		return fmt.Errorf("%w: failed to Get gzipReaderPool: %w", ErrDecompress, gr.err)
+	}
+	defer putGzipReader(g.GzipReaderPool, gr)
+	gr.in.Reset(data)
+	if err := gr.r.Reset(&gr.in); err != nil {
+		return fmt.Errorf("%w: failed to Reset gzip Reader: %w", ErrDecompress, err)
+	}
+
+	*out = JsonData{Items: out.Items[:0]}
+	d := getJSONDecoder(jsonDecoderPool, gr.r)
+	err := d.dec.Decode(out)
+	if err == nil {
+		err = expectJSONEOF(d.dec)
+	}
+	putJSONDecoder(d, err)
+	if err != nil {
+		return fmt.Errorf("%w: failed to Decode: %w", ErrDecompress, err)
+	}
+	if out.Items == nil {
+		out.Items = []string{}
+	}
+	return nil
+}
+
+func TestGunzipperWithSyncPoolGunzipJSON(t *testing.T) {
+	g := NewGunzipperWithSyncPool()
+	records := []JsonData{
+		{ID: 1, Name: "Jack", Items: []string{"knife", "shield", "herbs"}},
+		{ID: 2, Name: "Jill", Items: []string{"bow"}},
+		{ID: 3, Name: "Bob", Items: []string{}},
+	}
+	inputs := []string{
+		`{"id":1,"name":"Jack","items":["knife","shield","herbs"]}`,
+		`{"id":2,"name":"Jill","items":["bow"]}`,
+		// itemsがなくても前の値は残らない
+		`{"id":3,"name":"Bob"}`,
+	}
+
+	// itemsがないときは、新しいoutでも使い回したoutでも空のsliceになる
+	for _, in := range []string{`{"id":3,"name":"Bob"}`, `{"id":3,"name":"Bob","items":null}`} {
+		var out JsonData
+		if err := g.GunzipJSON(mustGzip(t, in), &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.Items == nil || !reflect.DeepEqual(out, records[2]) {
+			t.Errorf("%s: got: %#v, want: %#v", in, out, records[2])
+		}
+	}
+	compressed := make([][]byte, len(inputs))
+	for i, in := range inputs {
+		compressed[i] = mustGzip(t, in)
+	}
+
+	// 同じGunzipperを複数のgoroutineから使う。-raceで実行して、gzipReaderとDecoderを共有していないことを確認する
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// goroutineごとに1つのoutを使い回す
+			var out JsonData
+			for i := 0; i < 50; i++ {
+				j := i % len(inputs)
+				if err := g.GunzipJSON(compressed[j], &out); err != nil {
+					t.Error(err)
+					return
+				}
+				if !reflect.DeepEqual(out, records[j]) {
+					t.Errorf("got: %v, want: %v", out, records[j])
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestGunzipperWithSyncPoolGunzipJSONErrors(t *testing.T) {
+	g := NewGunzipperWithSyncPool()
+	in := `{"id":1,"name":"Jack","items":["knife","shield","herbs"]}`
+	broken := mustGzip(t, in)
+	broken[len(broken)-5] ^= 0xff // CRCを壊す
+
+	tests := map[string]struct {
+		in   []byte
+		want error
+	}{
+		"not_gzip":  {in: []byte("not gzip"), want: ErrDecompress},
+		"not_json":  {in: mustGzip(t, "not json"), want: ErrDecompress},
+		"corrupted": {in: broken, want: ErrDecompress},
+		"trailing":  {in: mustGzip(t, in+in), want: errJSONTrailing},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out JsonData
+			if err := g.GunzipJSON(tc.in, &out); !errors.Is(err, tc.want) {
+				t.Errorf("got: %v, want: %v", err, tc.want)
+			}
+		})
+	}
+}
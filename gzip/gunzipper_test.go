@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"testing"
+)
+
+// Gunzipper は1つのgoroutineが専用に持って使い続けるためのgunzip
+// sync.PoolのGet/Putをせずに、持っているgzip.Readerと展開先のbufをそのまま使い回す
+// 1つのgoroutineでループしながら展開する場合は、sync.Poolを使うより速い
+// 複数のgoroutineから同時に使ってはいけない。goroutineごとにNewGunzipperで作ること
+type Gunzipper struct {
+	r   *gzip.Reader
+	in  bytes.Reader
+	buf bytes.Buffer
+}
+
+func NewGunzipper() (*Gunzipper, error) {
+	r, err := EmptyGzipReader()
+	if err != nil {
+		return nil, err
+	}
+	return &Gunzipper{r: r}, nil
+}
+
+// Gunzip はdataを展開して返す
+// 返り値はGunzipperのbufを参照しているので、次にGunzipを呼ぶまでの間だけ使える
+// それより長く持っておく場合はコピーすること
+func (g *Gunzipper) Gunzip(data []byte) ([]byte, error) {
+	g.buf.Reset()
+	g.in.Reset(data)
+	defer g.in.Reset(nil) // 呼び出し元のdataを参照し続けないようにする
+	// bytes.Readerはio.ByteReaderなので、Resetでbufio.Readerが作られない
+	if err := g.r.Reset(&g.in); err != nil {
+		return nil, fmt.Errorf("%w: failed to Reset gzip Reader: %w", ErrDecompress, err)
+	}
+	if _, err := g.buf.ReadFrom(g.r); err != nil {
+		return nil, fmt.Errorf("%w: failed to read gzip Reader: %w", ErrDecompress, err)
+	}
+	return g.buf.Bytes(), nil
+}
+
+func TestGunzipper(t *testing.T) {
+	g, err := NewGunzipper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		want := fmt.Sprintf("%s-%d", data, i)
+		compressed, err := Gzip([]byte(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := g.Gunzip(compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("got: %s, want: %s", string(got), want)
+		}
+	}
+
+	// 壊れた入力でエラーになった後も使える
+	if _, err := g.Gunzip([]byte("not gzip")); err == nil {
+		t.Error("want error for non-gzip input")
+	}
+	got, err := g.Gunzip(gzippedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Errorf("got: %s, want: %s", string(got), data)
+	}
+}
+
+// 1つのgoroutineで展開し続ける場合
+// GunzipWithGzipReaderPoolは入力をio.Readerで受けるので、gzip.Reader.Resetの中で毎回bufio.Readerが作られる分も差に含まれる
+// BenchmarkGunzipperSingleGoroutine                         351715              2962 ns/op               0 B/op          0 allocs/op
+// BenchmarkGunzipWithGzipReaderPoolSingleGoroutine          286754              4089 ns/op            4240 B/op          3 allocs/op
+func BenchmarkGunzipperSingleGoroutine(b *testing.B) {
+	g, err := NewGunzipper()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		r, _ = g.Gunzip(gzippedData)
+	}
+	Result = r
+}
+
+func BenchmarkGunzipWithGzipReaderPoolSingleGoroutine(b *testing.B) {
+	b.ReportAllocs()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		r, _ = GunzipWithGzipReaderPool(bytes.NewReader(gzippedData))
+	}
+	Result = r
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// GzipAll はrを最後まで読みながらgzipして、結果をコピーして返す
+// rの長さが分からなくてもよい。少しずつしか返さないReaderでも、PoolのbufでまとめてからgzipWriterに書き込む
+// rがLen()を持っていれば、その大きさを目安にPoolのbufを先に広げておく
+func GzipAll(r io.Reader) ([]byte, error) {
+	gw := gzipWriterPool.Get().(*gzipWriter)
+	gw.markGet()
+	defer putUnlessPanic(&gzipWriterPool, gw)
+	gw.buf.Reset()
+	gw.w.Reset(gw.buf)
+	if l, ok := r.(interface{ Len() int }); ok {
+		gw.buf.Grow(l.Len())
+	}
+
+	// gzip.Writerからbytes.Bufferへの書き込みは失敗しないので、エラーはrの読み込みによるもの
+	if _, err := copyWithPool(gw.w, r); err != nil {
+		return nil, fmt.Errorf("%w: failed to read input: %w", ErrRead, err)
+	}
+	if err := gw.w.Close(); err != nil {
+		return nil, fmt.Errorf("%w: failed to gzip Close: %w", ErrCompress, err)
+	}
+
+	res := make([]byte, gw.buf.Len())
+	copy(res, gw.buf.Bytes())
+	return res, nil
+}
+
+func TestGzipAll(t *testing.T) {
+	large := strings.Repeat(data, 1000)
+	tests := map[string]struct {
+		r    func() io.Reader
+		want string
+	}{
+		"empty":          {func() io.Reader { return strings.NewReader("") }, ""},
+		"strings.Reader": {func() io.Reader { return strings.NewReader(data) }, data},
+		// 1回のReadで1バイトしか返さないReader
+		"one_byte":       {func() io.Reader { return iotest.OneByteReader(strings.NewReader(data)) }, data},
+		"one_byte_large": {func() io.Reader { return iotest.OneByteReader(strings.NewReader(large)) }, large},
+		// 最後のデータと一緒にEOFを返すReader
+		"data_err": {func() io.Reader { return iotest.DataErrReader(strings.NewReader(data)) }, data},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				res, err := GzipAll(tt.r())
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := Gunzip(bytes.NewReader(res))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != tt.want {
+					t.Errorf("got %d bytes, want %d bytes", len(got), len(tt.want))
+				}
+			}
+		})
+	}
+
+	t.Run("read_error", func(t *testing.T) {
+		_, err := GzipAll(&brokenReader{r: strings.NewReader(data), n: 10})
+		if !errors.Is(err, ErrRead) || !errors.Is(err, errBrokenReader) {
+			t.Errorf("got: %v, want: %v and %v", err, ErrRead, errBrokenReader)
+		}
+	})
+}
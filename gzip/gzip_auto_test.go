@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// GzipAutoThreshold より小さい入力はGzipAutoでBestSpeedで圧縮する
+// 小さい入力は圧縮レベルを上げても大きさはほとんど変わらず、CPUだけ余計にかかる
+var GzipAutoThreshold = 1024
+
+// 圧縮レベルごとのgzipWriterのPool
+// gzip.Writer.Resetは作った時のレベルを引き継ぐので、レベルごとにPoolを分ける
+var gzipLevelWriterPools = map[int]*sync.Pool{
+	gzip.BestSpeed:          newGzipLevelWriterPool(gzip.BestSpeed),
+	gzip.DefaultCompression: newGzipLevelWriterPool(gzip.DefaultCompression),
+}
+
+func newGzipLevelWriterPool(level int) *sync.Pool {
+	return &sync.Pool{
+		New: func() interface{} {
+			buf := &bytes.Buffer{}
+			// levelは上のmapのキーだけなので、NewWriterLevelはエラーを返さない
+			w, _ := gzip.NewWriterLevel(buf, level)
+			return &gzipWriter{
+				w:   w,
+				buf: buf,
+			}
+		},
+	}
+}
+
+// gzipAutoLevel はGzipAutoがn バイトの入力に使う圧縮レベルを返す
+func gzipAutoLevel(n int) int {
+	if n < GzipAutoThreshold {
+		return gzip.BestSpeed
+	}
+	return gzip.DefaultCompression
+}
+
+// GzipAuto はdataの大きさに合わせて圧縮レベルを選んでgzipする。返り値はPoolのbufからコピーしたもの
+func GzipAuto(data []byte) ([]byte, error) {
+	pool := gzipLevelWriterPools[gzipAutoLevel(len(data))]
+	gw := pool.Get().(*gzipWriter)
+	gw.markGet()
+	defer putUnlessPanic(pool, gw)
+	gw.buf.Reset()
+	gw.w.Reset(gw.buf)
+
+	if _, err := gw.w.Write(data); err != nil {
+		return nil, fmt.Errorf("%w: failed to gzip Write: %w", ErrCompress, err)
+	}
+	if err := gw.w.Close(); err != nil {
+		return nil, fmt.Errorf("%w: failed to gzip Close: %w", ErrCompress, err)
+	}
+
+	res := make([]byte, gw.buf.Len())
+	copy(res, gw.buf.Bytes())
+	return res, nil
+}
+
+// gzipWithLevel はPoolを使わずにlevelでgzipする。テストでGzipAutoの結果と比べるために使う
+func gzipWithLevel(data []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func TestGzipAuto(t *testing.T) {
+	small := sizedInput(GzipAutoThreshold - 1)
+	large := sizedInput(GzipAutoThreshold * 64)
+
+	tests := map[string]struct {
+		in    []byte
+		level int
+	}{
+		"small":     {small, gzip.BestSpeed},
+		"threshold": {sizedInput(GzipAutoThreshold), gzip.DefaultCompression},
+		"large":     {large, gzip.DefaultCompression},
+	}
+
+	// 大きさの違う入力を交互に圧縮しても、レベルの違うWriterが混ざらないことを確認する
+	for i := 0; i < 2; i++ {
+		for name, tt := range tests {
+			t.Run(name, func(t *testing.T) {
+				got, err := GzipAuto(tt.in)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// 同じレベルで圧縮した結果と完全に一致すれば、そのレベルが選ばれている
+				want, err := gzipWithLevel(tt.in, tt.level)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("GzipAuto output (%d bytes) differs from level %d output (%d bytes)", len(got), tt.level, len(want))
+				}
+				res, err := Gunzip(bytes.NewReader(got))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(res, tt.in) {
+					t.Errorf("round trip mismatch: got %d bytes, want %d bytes", len(res), len(tt.in))
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+	"time"
+)
+
+// GzipDeterministicで使うgzip headerのOS。255はunknown
+const deterministicGzipOS byte = 255
+
+// GzipDeterministic は同じ入力に対して常に同じバイト列を返すGzip
+// ModTimeやOSがheaderに入ると同じデータでも結果が変わってしまい、
+// 圧縮結果のハッシュをキーにしたキャッシュなどで困るので、最初のWriteの前に固定値を入れる
+func GzipDeterministic(data []byte) ([]byte, error) {
+	gw := gzipWriterPool.Get().(*gzipWriter)
+	defer gzipWriterPool.Put(gw)
+	gw.buf.Reset()
+	gw.w.Reset(gw.buf)
+	gw.w.Header = gzip.Header{
+		ModTime: time.Time{},
+		OS:      deterministicGzipOS,
+	}
+
+	if err := gzipWriteClose(gw.w, data); err != nil {
+		return nil, err
+	}
+
+	res := make([]byte, gw.buf.Len())
+	copy(res, gw.buf.Bytes())
+	return res, nil
+}
+
+func TestGzipDeterministic(t *testing.T) {
+	res1, err := GzipDeterministic([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 他の呼び出し元がheaderを書き換えたWriterをPoolに戻していても結果は変わらない
+	gw := gzipWriterPool.Get().(*gzipWriter)
+	gw.w.Header.ModTime = time.Now()
+	gw.w.Header.OS = 3
+	gw.w.Header.Name = "dirty.txt"
+	gzipWriterPool.Put(gw)
+
+	res2, err := GzipDeterministic([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res1, res2) {
+		t.Errorf("got different outputs:\n%v\n%v", res1, res2)
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(res2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gr.Header.ModTime.IsZero() {
+		t.Errorf("ModTime: %v, want zero", gr.Header.ModTime)
+	}
+	if gr.Header.OS != deterministicGzipOS {
+		t.Errorf("OS: %d, want: %d", gr.Header.OS, deterministicGzipOS)
+	}
+
+	got, err := Gunzip(bytes.NewReader(res2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Errorf("got: %s, want: %s", string(got), data)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// gzipのエラーの種類。errors.Isで判定できるように、元のエラーと一緒にwrapして返す
+var (
+	ErrCompress   = errors.New("compress error")
+	ErrDecompress = errors.New("decompress error")
+	ErrRead       = errors.New("read error")
+)
+
+// errRecordingReader は元のReaderが返したエラーを記録しておくReader
+// gzip.Readerは元のReaderのエラーをそのまま返すので、
+// 記録したエラーと比べることで、データが壊れているのか読み込みに失敗したのかを区別する
+type errRecordingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (e *errRecordingReader) reset(r io.Reader) {
+	e.r = r
+	e.err = nil
+}
+
+func (e *errRecordingReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil && err != io.EOF {
+		e.err = err
+	}
+	return n, err
+}
+
+// wrapErr はerrが元のReaderのエラーならErrRead、そうでなければErrDecompressでwrapする
+func (e *errRecordingReader) wrapErr(msg string, err error) error {
+	if e.err != nil && errors.Is(err, e.err) {
+		return fmt.Errorf("%w: %s: %w", ErrRead, msg, err)
+	}
+	return fmt.Errorf("%w: %s: %w", ErrDecompress, msg, err)
+}
+
+// gzipWriteClose はdataをzwに書き込んでCloseする。失敗したらErrCompressでwrapして返す
+func gzipWriteClose(zw *gzip.Writer, data []byte) error {
+	if _, err := zw.Write(data); err != nil {
+		return fmt.Errorf("%w: failed to gzip Write: %w", ErrCompress, err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("%w: failed to gzip Close: %w", ErrCompress, err)
+	}
+	return nil
+}
+
+var errBrokenReader = errors.New("broken reader")
+
+// n バイト読んだ後にerrBrokenReaderを返すReader
+type brokenReader struct {
+	r io.Reader
+	n int
+}
+
+func (b *brokenReader) Read(p []byte) (int, error) {
+	if b.n <= 0 {
+		return 0, errBrokenReader
+	}
+	if len(p) > b.n {
+		p = p[:b.n]
+	}
+	n, err := b.r.Read(p)
+	b.n -= n
+	return n, err
+}
+
+func TestGzipErrors(t *testing.T) {
+	compressed, err := Gzip([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := append([]byte{}, compressed...)
+	corrupt[len(corrupt)/2] ^= 0xff
+
+	gunzips := map[string]func(io.Reader) ([]byte, error){
+		"GunzipWithGzipReaderPool": GunzipWithGzipReaderPool,
+		"GunzipperWithSyncPool":    NewGunzipperWithSyncPool().Gunzip,
+	}
+	for name, gunzip := range gunzips {
+		t.Run(name, func(t *testing.T) {
+			// 壊れたデータ
+			_, err := gunzip(bytes.NewReader(corrupt))
+			if !errors.Is(err, ErrDecompress) {
+				t.Errorf("corrupt: got: %v, want: %v", err, ErrDecompress)
+			}
+			if errors.Is(err, ErrRead) {
+				t.Errorf("corrupt: got: %v, should not be %v", err, ErrRead)
+			}
+
+			// headerを読んでいる途中と、本体を読んでいる途中での読み込みエラー
+			for _, n := range []int{0, 5, len(compressed) / 2} {
+				_, err = gunzip(&brokenReader{r: bytes.NewReader(compressed), n: n})
+				if !errors.Is(err, ErrRead) || !errors.Is(err, errBrokenReader) {
+					t.Errorf("broken reader(n=%d): got: %v, want: %v and %v", n, err, ErrRead, errBrokenReader)
+				}
+				if errors.Is(err, ErrDecompress) {
+					t.Errorf("broken reader(n=%d): got: %v, should not be %v", n, err, ErrDecompress)
+				}
+			}
+
+			// エラーの後も正しく展開できる
+			got, err := gunzip(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != data {
+				t.Errorf("got: %s, want: %s", string(got), data)
+			}
+		})
+	}
+}
+
+var errBrokenWriter = errors.New("broken writer")
+
+// n バイト書いた後にerrBrokenWriterを返すWriter
+type brokenWriter struct {
+	n int
+}
+
+func (b *brokenWriter) Write(p []byte) (int, error) {
+	if len(p) > b.n {
+		n := b.n
+		b.n = 0
+		return n, errBrokenWriter
+	}
+	b.n -= len(p)
+	return len(p), nil
+}
+
+// AppendGzip、GzipperWithBoundedPool.Gzip、GzipDeterministicはgzipWriteCloseでgw.bufに書き込む
+// bytes.Bufferへの書き込みは失敗しないので、書き込み先が壊れたgzip.Writerで直接確かめる
+func TestGzipWriteCloseErrors(t *testing.T) {
+	tests := map[string]int{
+		// 最初のWriteでheaderの書き込みに失敗する
+		"write": 0,
+		// headerの10バイトは書けて、Closeで圧縮したデータを書き出す時に失敗する
+		"close": 10,
+	}
+	for name, n := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := gzipWriteClose(gzip.NewWriter(&brokenWriter{n: n}), []byte(data))
+			if !errors.Is(err, ErrCompress) || !errors.Is(err, errBrokenWriter) {
+				t.Errorf("got: %v, want: %v and %v", err, ErrCompress, errBrokenWriter)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var (
+	errNotJSONArray = errors.New("input is not a JSON array")
+	errJSONTrailing = errors.New("unexpected data after JSON value")
+)
+
+// DecodeGzipJSONArrayで配列の要素を1つずつデコードするJsonDataのPool
+var jsonDataPool = sync.Pool{
+	New: func() interface{} {
+		return &JsonData{}
+	},
+}
+
+// DecodeGzipJSONArray はgzipされたJSONの配列srcを展開しながら、要素を1つずつJsonDataにしてfnに渡す
+// 展開した[]byteも、デコードした[]JsonDataも作らないので、大きな配列でもメモリに全部を持たない
+// fnに渡すJsonDataのItemsはPoolの配列を使い回しているので、fnの外で使うときはCloneすること
+// fnがエラーを返したらそこで止めて、そのエラーをそのまま返す
+func DecodeGzipJSONArray(src []byte, fn func(JsonData) error) error {
+	gr := gzipReaderPool.Get().(*gzipReader)
+	if gr.err != nil {
+		return fmt.Errorf("%w: failed to Get gzipReaderPool: %w", ErrDecompress, gr.err)
+	}
+	defer putGzipReader(&gzipReaderPool, gr)
+	gr.in.Reset(src)
+	if err := gr.r.Reset(&gr.in); err != nil {
+		return fmt.Errorf("%w: failed to Reset gzip Reader: %w", ErrDecompress, err)
+	}
+
+	v := jsonDataPool.Get().(*JsonData)
+	defer func() {
+		// Poolに戻したJsonDataのItemsが前の文字列を参照し続けないようにする
+		clear(v.Items[:cap(v.Items)])
+		*v = JsonData{Items: v.Items[:0]}
+		jsonDataPool.Put(v)
+	}()
+
+	d := getJSONDecoder(jsonDecoderPool, gr.r)
+	err := decodeJSONArray(d.dec, v, fn)
+	// fnのエラーで止めたときもDecoderに配列の残りが入っているので、Poolに戻さない
+	putJSONDecoder(d, err)
+	var fnErr *jsonArrayFuncError
+	if errors.As(err, &fnErr) {
+		return fnErr.err
+	}
+	if err != nil {
+		return fmt.Errorf("%w: failed to Decode: %w", ErrDecompress, err)
+	}
+	return nil
+}
+
+// jsonArrayFuncError はfnが返したエラーをDecodeのエラーと区別するためのもの
+type jsonArrayFuncError struct {
+	err error
+}
+
+func (e *jsonArrayFuncError) Error() string {
+	return e.err.Error()
+}
+
+func decodeJSONArray(dec *json.Decoder, v *JsonData, fn func(JsonData) error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("%w: got %v", errNotJSONArray, tok)
+	}
+	for dec.More() {
+		// 前の要素の値が残らないように空にしてからDecodeする。Itemsの配列は使い回す
+		*v = JsonData{Items: v.Items[:0]}
+		if err := dec.Decode(v); err != nil {
+			return err
+		}
+		if err := fn(*v); err != nil {
+			return &jsonArrayFuncError{err: err}
+		}
+	}
+	// 閉じ括弧の']'を読む
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	return expectJSONEOF(dec)
+}
+
+// expectJSONEOF はdecを最後まで読んで、gzipのCRCの確認と値の後ろに余計なデータがないことの確認をする
+// Tokenのio.EOFはDecoderに残らないので、このDecoderはPoolに戻せる
+func expectJSONEOF(dec *json.Decoder) error {
+	if tok, err := dec.Token(); err != io.EOF {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: got %v", errJSONTrailing, tok)
+	}
+	return nil
+}
+
+func TestDecodeGzipJSONArray(t *testing.T) {
+	in := `[
+		{"id":1,"name":"Jack","items":["knife","shield","herbs"]},
+		{"id":2,"name":"Emma"},
+		{"id":3,"name":"Liam","items":["bow"]}
+	]`
+	want := []JsonData{
+		{ID: 1, Name: "Jack", Items: []string{"knife", "shield", "herbs"}},
+		{ID: 2, Name: "Emma", Items: []string{}},
+		{ID: 3, Name: "Liam", Items: []string{"bow"}},
+	}
+	compressed := mustGzip(t, in)
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		var got []JsonData
+		err := DecodeGzipJSONArray(compressed, func(v JsonData) error {
+			// ItemsはPoolの配列なので、Cloneして残す
+			v.Items = append([]string{}, v.Items...)
+			got = append(got, v)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("got: %v, want: %v, diff: %s", got, want, diff)
+		}
+	}
+}
+
+func TestDecodeGzipJSONArrayErrors(t *testing.T) {
+	errStop := errors.New("stop")
+	broken := mustGzip(t, `[{"id":1},{"id":2}]`)
+	broken[len(broken)-5] ^= 0xff // CRCを壊す
+
+	tests := map[string]struct {
+		src  []byte
+		fn   func(JsonData) error
+		want error
+	}{
+		"not_gzip":   {src: []byte("not gzip"), want: ErrDecompress},
+		"not_array":  {src: mustGzip(t, `{"id":1}`), want: errNotJSONArray},
+		"trailing":   {src: mustGzip(t, `[{"id":1}] {"id":2}`), want: errJSONTrailing},
+		"corrupted":  {src: broken, want: ErrDecompress},
+		"invalid":    {src: mustGzip(t, `[{"id":"x"}]`), want: ErrDecompress},
+		"fn_error":   {src: mustGzip(t, `[{"id":1},{"id":2}]`), fn: func(JsonData) error { return errStop }, want: errStop},
+		"unexpected": {src: mustGzip(t, `[{"id":1}`), want: ErrDecompress},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fn := tc.fn
+			if fn == nil {
+				fn = func(JsonData) error { return nil }
+			}
+			if err := DecodeGzipJSONArray(tc.src, fn); !errors.Is(err, tc.want) {
+				t.Errorf("got: %v, want: %v", err, tc.want)
+			}
+		})
+	}
+
+	// fnのエラーで止めても、次の呼び出しは最初から正しくデコードできる
+	var n int
+	err := DecodeGzipJSONArray(mustGzip(t, strings.Repeat(" ", 10)+`[{"id":1}]`), func(v JsonData) error {
+		n++
+		if v.ID != 1 {
+			t.Errorf("got: %d, want: %d", v.ID, 1)
+		}
+		return nil
+	})
+	if err != nil || n != 1 {
+		t.Errorf("got: %d elements, %v, want: 1 element, nil", n, err)
+	}
+}
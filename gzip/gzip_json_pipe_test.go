@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// GzipJSONPipe はinをJSONにしてgzipしたものを読み出せるio.Readerを返す
+// 書き込みは別のgoroutineでio.Pipeに対して行うので、全体を[]byteに貯めずに読んだ分だけ作られる
+// テストでDecodeGzipJSONResponseなどに一時ファイルなしでgzipされたJSONを渡すためのもの
+// 書き込み側のgoroutineは読み終わるまで終わらないので、返したReaderは必ずEOFまで読み切ること
+// Encodeやgzipのエラーは返したReaderのReadのエラーとして返る
+func GzipJSONPipe(in JsonData) (io.Reader, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeGzipJSON(pw, in))
+	}()
+	return pr, nil
+}
+
+// writeGzipJSON はPoolのgzipWriterNoBufとjsonEncoderでinをwに書き込む
+func writeGzipJSON(w io.Writer, in JsonData) error {
+	gw := getGzipWriterNoBuf(w)
+	defer putUnlessPanic(&gzipWriterNoBufPool, gw)
+	// Poolに戻した後に呼び出し元のWriterを参照し続けないように、io.Discardに向けておく
+	defer gw.w.Reset(io.Discard)
+
+	e := getJSONEncoder(gw.w)
+	err := e.enc.Encode(in)
+	putJSONEncoder(e, err)
+	if err != nil {
+		return fmt.Errorf("%w: failed to Encode: %w", ErrCompress, err)
+	}
+	if err := gw.w.Close(); err != nil {
+		return fmt.Errorf("%w: failed to gzip Close: %w", ErrCompress, err)
+	}
+	return nil
+}
+
+// drainCloser はCloseで残りを読み捨てる
+// DecodeGzipJSONResponseはJSONを読み終わったところでやめるので、gzipのフッタが読まれずに残ると
+// GzipJSONPipeの書き込み側のgoroutineが終わらない
+type drainCloser struct {
+	io.Reader
+}
+
+func (d drainCloser) Close() error {
+	_, err := io.Copy(io.Discard, d.Reader)
+	return err
+}
+
+func TestGzipJSONPipe(t *testing.T) {
+	want := JsonData{
+		ID:    1,
+		Name:  "Jack",
+		Items: []string{"knife", "shield", "herbs"},
+	}
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		r, err := GzipJSONPipe(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := &http.Response{
+			Header: http.Header{"Content-Encoding": []string{"gzip"}},
+			Body:   drainCloser{r},
+		}
+		got, err := DecodeGzipJSONResponse(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got: %v, want: %v", got, want)
+		}
+	}
+
+	// 展開するとEncodeが最後に付ける改行まで含めたJSONになっている
+	r, err := GzipJSONPipe(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Gunzip(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.TrimRight(string(got), "\n"); s != `{"id":1,"name":"Jack","items":["knife","shield","herbs"]}` {
+		t.Errorf("got: %s", s)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// gzipJSONReader はNewGzipJSONReaderが返すReadCloser
+type gzipJSONReader struct {
+	in   JsonData
+	pr   *io.PipeReader
+	pw   *io.PipeWriter
+	once sync.Once
+	done chan struct{} // 書き込み側のgoroutineが終わったらcloseする
+}
+
+// NewGzipJSONReader はinをJSONにしてgzipしたものを読み出せるReadCloserを返す
+// GzipJSONPipeと違って、最初にReadされるまでPoolのgzipWriterとjsonEncoderを取らない
+// Closeすると途中でも書き込みをやめて、書き込み側のgoroutineがPoolに戻し終わるのを待つ
+// http.Request.Bodyに渡せば、圧縮したJSONを[]byteに貯めずにPOSTできる
+func NewGzipJSONReader(in JsonData) io.ReadCloser {
+	pr, pw := io.Pipe()
+	return &gzipJSONReader{
+		in:   in,
+		pr:   pr,
+		pw:   pw,
+		done: make(chan struct{}),
+	}
+}
+
+func (g *gzipJSONReader) start() {
+	go func() {
+		defer close(g.done)
+		g.pw.CloseWithError(writeGzipJSON(g.pw, g.in))
+	}()
+}
+
+func (g *gzipJSONReader) Read(p []byte) (int, error) {
+	g.once.Do(g.start)
+	return g.pr.Read(p)
+}
+
+// Close は読み込み側を閉じる。書き込み側のgoroutineはWriteがエラーになって終わる
+func (g *gzipJSONReader) Close() error {
+	started := true
+	g.once.Do(func() { started = false })
+	g.pr.Close()
+	if started {
+		<-g.done
+	}
+	return nil
+}
+
+func TestNewGzipJSONReader(t *testing.T) {
+	want := JsonData{
+		ID:    1,
+		Name:  "Jack",
+		Items: []string{"knife", "shield", "herbs"},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			http.Error(w, "want gzip", http.StatusBadRequest)
+			return
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var got JsonData
+		if err := json.NewDecoder(zr).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(got)
+	}))
+	defer ts.Close()
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodPost, ts.URL, NewGzipJSONReader(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got JsonData
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status: %d", resp.StatusCode)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got: %v, want: %v", got, want)
+		}
+	}
+}
+
+func TestNewGzipJSONReaderClose(t *testing.T) {
+	in := JsonData{ID: 1, Name: "Jack"}
+
+	// 一度も読まずにCloseしても、goroutineは起動されない
+	r := NewGzipJSONReader(in)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(make([]byte, 1)); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("Read after Close: got %v, want %v", err, io.ErrClosedPipe)
+	}
+
+	// 途中まで読んでCloseすると、書き込み側のgoroutineが終わるまで待つ
+	r = NewGzipJSONReader(in)
+	if _, err := r.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-r.(*gzipJSONReader).done:
+	default:
+		t.Error("writer goroutine is still running after Close")
+	}
+}
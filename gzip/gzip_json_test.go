@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// jsonディレクトリのJsonDataと同じもの
+type JsonData struct {
+	ID    int      `json:"id"`
+	Name  string   `json:"name"`
+	Items []string `json:"items"`
+}
+
+// jsonDecoderとjsonEncoderはjsonディレクトリのjson_test.goと同じもの
+// ディレクトリごとに別のpackage mainなので共有できない。片方を変えたらもう片方も同じように変えること
+
+// jsonDecoder はjson.Decoderの読み込み元を差し替えられるようにしたもの
+// json.DecoderにはResetがないので、自分自身をio.Readerとして渡しておき、
+// 読み込みをrから行うことでDecoderごとPoolで使いまわす
+type jsonDecoder struct {
+	r     io.Reader
+	dec   *json.Decoder
+	start int64      // 今回の入力の先頭のInputOffset
+	pool  *sync.Pool // 取り出したPool
+
+	// moreInputで先読みした1バイト。次のReadで先に返す
+	peekBuf [1]byte
+	peeked  []byte
+}
+
+func (d *jsonDecoder) Read(p []byte) (int, error) {
+	if len(d.peeked) > 0 {
+		n := copy(p, d.peeked)
+		d.peeked = d.peeked[n:]
+		return n, nil
+	}
+	return d.r.Read(p)
+}
+
+// InputOffset は今回の入力の先頭からのオフセットを返す
+func (d *jsonDecoder) InputOffset() int64 {
+	return d.dec.InputOffset() - d.start
+}
+
+// moreInput はまだデコードしていない入力が残っているかを返す
+// json.DecoderのMoreやDecodeは入力の終わりに達するとio.EOFを保持して使えなくなるので、
+// Decoderのバッファが空白だけのときは、rから1バイトずつ先読みして終わりかどうかを確認する
+// 空白以外を先読みしたら、そのバイトは次のReadでDecoderに渡す
+func (d *jsonDecoder) moreInput() (bool, error) {
+	if rest, ok := d.dec.Buffered().(*bytes.Reader); ok {
+		for rest.Len() > 0 {
+			if c, _ := rest.ReadByte(); c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+				return true, nil
+			}
+		}
+	}
+	for {
+		n, err := d.r.Read(d.peekBuf[:])
+		if n > 0 {
+			if c := d.peekBuf[0]; c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+				// 空白はDecoderに渡さずに読み捨てるので、その分InputOffsetの基準をずらしておく
+				d.start--
+				continue
+			}
+			d.peeked = d.peekBuf[:n]
+			return true, nil
+		}
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// newJSONDecoderPool はsetupで設定したjson.DecoderのPoolを作る
+// DisallowUnknownFieldsなどの設定は後から解除できないので、設定ごとにPoolを分ける
+func newJSONDecoderPool(setup func(dec *json.Decoder)) *sync.Pool {
+	pool := &sync.Pool{}
+	pool.New = func() interface{} {
+		d := &jsonDecoder{pool: pool}
+		d.dec = json.NewDecoder(d)
+		if setup != nil {
+			setup(d.dec)
+		}
+		return d
+	}
+	return pool
+}
+
+var jsonDecoderPool = newJSONDecoderPool(nil)
+
+func getJSONDecoder(pool *sync.Pool, r io.Reader) *jsonDecoder {
+	d := pool.Get().(*jsonDecoder)
+	d.r = r
+	d.peeked = nil
+	return d
+}
+
+// putJSONDecoder はDecoderをPoolに戻す
+// json.Decoderはエラー(Decodeで読み切った時のio.EOFも含む)を保持し続けるうえ、
+// 読み込んだ後の余りのデータをバッファに持っているので、
+// エラーが起きたときや空白以外の余りがあるときはPoolに戻さずに捨てる
+func putJSONDecoder(d *jsonDecoder, err error) {
+	d.r = nil // 呼び出し元のReaderを参照し続けないようにする
+	if err != nil || len(d.peeked) > 0 {
+		return
+	}
+	rest, ok := d.dec.Buffered().(*bytes.Reader)
+	if !ok {
+		return
+	}
+	// 余りの空白は次のDecodeで読み飛ばされるので、その分だけ次の入力の先頭がずれる
+	d.start = d.dec.InputOffset() + int64(rest.Len())
+	for rest.Len() > 0 {
+		c, _ := rest.ReadByte()
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			return
+		}
+	}
+	d.pool.Put(d)
+}
+
+// jsonEncoder はjson.Encoderの書き込み先を差し替えられるようにしたもの
+// json.EncoderにはResetがないので、自分自身をio.Writerとして渡しておき、
+// 書き込みをwに転送することでEncoderごとPoolで使いまわす
+type jsonEncoder struct {
+	w   io.Writer
+	enc *json.Encoder
+}
+
+func (e *jsonEncoder) Write(p []byte) (int, error) {
+	return e.w.Write(p)
+}
+
+var jsonEncoderPool = &sync.Pool{
+	New: func() interface{} {
+		e := &jsonEncoder{}
+		e.enc = json.NewEncoder(e)
+		return e
+	},
+}
+
+func getJSONEncoder(w io.Writer) *jsonEncoder {
+	e := jsonEncoderPool.Get().(*jsonEncoder)
+	e.w = w
+	return e
+}
+
+// putJSONEncoder はEncoderをPoolに戻す
+// json.Encoderは一度書き込みに失敗するとそのエラーを保持し続けるので、
+// エラーが起きたEncoderはPoolに戻さずに捨てる
+func putJSONEncoder(e *jsonEncoder, err error) {
+	e.w = nil // 呼び出し元のWriterを参照し続けないようにする
+	if err != nil {
+		return
+	}
+	jsonEncoderPool.Put(e)
+}
+
+// DecodeGzipJSONResponse はrespのBodyをJsonDataにデコードする
+// Content-Encodingがgzipのときは、PoolのgzipReaderを通してそのままデコードするので、
+// 途中で[]byteに読み出さない
+// resp.Bodyは必ずCloseする
+func DecodeGzipJSONResponse(resp *http.Response) (JsonData, error) {
+	defer resp.Body.Close()
+
+	var body io.Reader = resp.Body
+	wrapErr := func(msg string, err error) error {
+		return fmt.Errorf("%w: %s: %w", ErrDecompress, msg, err)
+	}
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gr := gzipReaderPool.Get().(*gzipReader)
+		if gr.err != nil {
+			return JsonData{}, fmt.Errorf("%w: failed to Get gzipReaderPool: %w", ErrDecompress, gr.err)
+		}
+		// wrapErrはgr.srcの記録したエラーを見るので、putGzipReaderは返り値を作った後のdeferで呼ぶ
+		defer putGzipReader(&gzipReaderPool, gr)
+		gr.src.reset(resp.Body)
+		wrapErr = gr.src.wrapErr
+		if err := gr.r.Reset(&gr.src); err != nil {
+			return JsonData{}, wrapErr("failed to Reset gzip Reader", err)
+		}
+		body = gr.r
+	}
+
+	var res JsonData
+	d := getJSONDecoder(jsonDecoderPool, body)
+	err := d.dec.Decode(&res)
+	putJSONDecoder(d, err)
+	if err != nil {
+		return JsonData{}, wrapErr("failed to Decode", err)
+	}
+	return res, nil
+}
+
+func TestDecodeGzipJSONResponse(t *testing.T) {
+	want := JsonData{
+		ID:    1,
+		Name:  "Jack",
+		Items: []string{"knife", "shield", "herbs"},
+	}
+	encoded := `{"id":1,"name":"Jack","items":["knife","shield","herbs"]}`
+	gzipped, err := Gzip([]byte(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(gzipped)
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(encoded))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	for i := 0; i < 2; i++ {
+		for _, path := range []string{"/gzip", "/plain"} {
+			t.Run(path, func(t *testing.T) {
+				req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Accept-Encodingを自分で指定しないと、http.Transportが勝手にgzipを展開してしまう
+				req.Header.Set("Accept-Encoding", "gzip")
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := DecodeGzipJSONResponse(resp)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("got: %v, want: %v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeGzipJSONResponseErrors(t *testing.T) {
+	encoded := `{"id":1,"name":"Jack","items":["knife","shield","herbs"]}`
+	gzipped, err := Gzip([]byte(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	brokenJSON, err := Gzip([]byte(`{"id":`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		body io.Reader
+		gzip bool
+		want error
+	}{
+		"not_gzip":          {body: strings.NewReader(encoded), gzip: true, want: ErrDecompress},
+		"broken_gzip_json":  {body: bytes.NewReader(brokenJSON), gzip: true, want: ErrDecompress},
+		"broken_plain_json": {body: strings.NewReader(`{"id":`), want: ErrDecompress},
+		"read_header":       {body: &brokenReader{r: bytes.NewReader(gzipped), n: 5}, gzip: true, want: ErrRead},
+		"read_body":         {body: &brokenReader{r: bytes.NewReader(gzipped), n: len(gzipped) / 2}, gzip: true, want: ErrRead},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}, Body: io.NopCloser(tc.body)}
+			if tc.gzip {
+				resp.Header.Set("Content-Encoding", "gzip")
+			}
+			if _, err := DecodeGzipJSONResponse(resp); !errors.Is(err, tc.want) {
+				t.Errorf("got: %v, want: %v", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// bufio.Scannerの最初のbufの大きさ(bufioのstartBufSizeと同じ)
+const lineScanBufSize = 4096
+
+// bufio.ScannerにはResetがなく、一度EOFまで読むと使いまわせないので、
+// Scannerそのものではなく読み込み用のbufをPoolで使いまわす
+var lineScanBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, lineScanBufSize)
+		return &b
+	},
+}
+
+// GzipLineScanner はgzipされたログなどを展開しながら1行ずつ読む
+// gzip.ReaderはPoolのgzipReaderを、bufio.ScannerのbufはPoolのものを使う
+// 読み終わったら必ずCloseしてPoolに戻すこと
+type GzipLineScanner struct {
+	gr  *gzipReader
+	buf *[]byte
+	sc  *bufio.Scanner
+}
+
+// NewGzipLineScanner はrを展開しながら1行ずつ読むGzipLineScannerを返す
+// maxTokenSizeは1行の最大の長さで、0以下ならbufio.MaxScanTokenSize(64KB)になる
+// これより長い行があるとScanがfalseを返し、Errがbufio.ErrTooLongになる
+func NewGzipLineScanner(r io.Reader, maxTokenSize int) (*GzipLineScanner, error) {
+	if maxTokenSize <= 0 {
+		maxTokenSize = bufio.MaxScanTokenSize
+	}
+	gr := gzipReaderPool.Get().(*gzipReader)
+	if gr.err != nil {
+		return nil, fmt.Errorf("%w: failed to Get gzipReaderPool: %w", ErrDecompress, gr.err)
+	}
+	gr.src.reset(r)
+	if err := gr.r.Reset(&gr.src); err != nil {
+		err = gr.src.wrapErr("failed to Reset gzip Reader", err)
+		// 次に使う時にResetしなおすので、失敗したものもPoolに戻してよい
+		gr.src.reset(nil)
+		gzipReaderPool.Put(gr)
+		return nil, err
+	}
+
+	buf := lineScanBufPool.Get().(*[]byte)
+	sc := bufio.NewScanner(gr.r)
+	// Scannerはmax(maxTokenSize, cap(buf))までの行を読めてしまうので、
+	// maxTokenSizeがPoolのbufより小さいときはcapを切り詰めて渡す
+	sc.Buffer((*buf)[:0:min(cap(*buf), maxTokenSize)], maxTokenSize)
+	return &GzipLineScanner{gr: gr, buf: buf, sc: sc}, nil
+}
+
+// Scan は次の行を読む。最後まで読んだかエラーが起きたらfalseを返す
+func (s *GzipLineScanner) Scan() bool {
+	if s.sc == nil {
+		return false
+	}
+	return s.sc.Scan()
+}
+
+// Text は最後にScanで読んだ行を改行を除いて返す
+func (s *GzipLineScanner) Text() string {
+	if s.sc == nil {
+		return ""
+	}
+	return s.sc.Text()
+}
+
+// Err はScanがfalseを返した原因のエラーを返す。最後まで読んだときはnil
+func (s *GzipLineScanner) Err() error {
+	if s.sc == nil {
+		return nil
+	}
+	if err := s.sc.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return err
+		}
+		return s.gr.src.wrapErr("failed to Scan", err)
+	}
+	return nil
+}
+
+// Close はgzipReaderとbufをPoolに戻す。2回目以降のCloseは何もしない
+func (s *GzipLineScanner) Close() error {
+	if s.sc == nil {
+		return nil
+	}
+	err := s.gr.r.Close()
+	s.gr.src.reset(nil) // Poolに戻した後に呼び出し元のReaderを参照し続けないようにする
+	gzipReaderPool.Put(s.gr)
+	// Scannerが長い行のためにbufを作り直していても、Poolに戻すのは最初に渡したbuf
+	lineScanBufPool.Put(s.buf)
+	s.gr, s.buf, s.sc = nil, nil, nil
+	return err
+}
+
+func TestGzipLineScanner(t *testing.T) {
+	longLine := strings.Repeat("x", 200*1024)
+	lines := []string{
+		"2024-01-01T00:00:00Z INFO start",
+		"",
+		"2024-01-01T00:00:01Z WARN " + longLine,
+		"2024-01-01T00:00:02Z INFO done",
+	}
+	compressed, err := Gzip([]byte(strings.Join(lines, "\n") + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		s, err := NewGzipLineScanner(bytes.NewReader(compressed), 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for s.Scan() {
+			got = append(got, s.Text())
+		}
+		if err := s.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(lines) {
+			t.Fatalf("got %d lines, want %d", len(got), len(lines))
+		}
+		for j := range lines {
+			if got[j] != lines[j] {
+				t.Errorf("line %d: got %d bytes, want %d bytes", j, len(got[j]), len(lines[j]))
+			}
+		}
+		if s.Scan() {
+			t.Error("Scan after Close returned true")
+		}
+	}
+
+	t.Run("too_long", func(t *testing.T) {
+		// デフォルトの64KBより長い行はErrTooLongになる
+		s, err := NewGzipLineScanner(bytes.NewReader(compressed), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		for s.Scan() {
+		}
+		if err := s.Err(); !errors.Is(err, bufio.ErrTooLong) {
+			t.Errorf("got: %v, want: %v", err, bufio.ErrTooLong)
+		}
+	})
+
+	t.Run("too_long_small_limit", func(t *testing.T) {
+		// Poolのbuf(4096バイト)より小さい上限でも守られる
+		small, err := Gzip([]byte("short\n" + strings.Repeat("y", 200) + "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := NewGzipLineScanner(bytes.NewReader(small), 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		var got []string
+		for s.Scan() {
+			got = append(got, s.Text())
+		}
+		if len(got) != 1 || got[0] != "short" {
+			t.Errorf("got: %q, want: %q", got, []string{"short"})
+		}
+		if err := s.Err(); !errors.Is(err, bufio.ErrTooLong) {
+			t.Errorf("got: %v, want: %v", err, bufio.ErrTooLong)
+		}
+	})
+
+	t.Run("corrupted", func(t *testing.T) {
+		broken := append([]byte{}, compressed...)
+		broken[len(broken)-5] ^= 0xff // CRCを壊す
+		s, err := NewGzipLineScanner(bytes.NewReader(broken), 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		for s.Scan() {
+		}
+		if err := s.Err(); !errors.Is(err, ErrDecompress) {
+			t.Errorf("got: %v, want: %v", err, ErrDecompress)
+		}
+	})
+
+	if _, err := NewGzipLineScanner(strings.NewReader("not gzip"), 0); !errors.Is(err, ErrDecompress) {
+		t.Errorf("got: %v, want: %v", err, ErrDecompress)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var (
+	errMarshalNil         = errors.New("GzipMarshal: v is nil")
+	errUnmarshalNotPtr    = errors.New("GunzipUnmarshal: v must be a non-nil pointer")
+	errUnmarshalEmptyData = errors.New("GunzipUnmarshal: data is empty")
+)
+
+// GzipMarshal はvをJSONにしてgzipしたものを返す
+// PoolのjsonEncoderをPoolのgzipWriterに直接つなぐので、途中のJSONの[]byteを作らない
+// 返り値はPoolのbufからコピーしたもの
+func GzipMarshal(v any) ([]byte, error) {
+	if v == nil {
+		return nil, errMarshalNil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil, errMarshalNil
+	}
+
+	gw := gzipWriterPool.Get().(*gzipWriter)
+	gw.markGet()
+	defer putUnlessPanic(&gzipWriterPool, gw)
+	gw.buf.Reset()
+	gw.w.Reset(gw.buf)
+
+	e := getJSONEncoder(gw.w)
+	err := e.enc.Encode(v)
+	putJSONEncoder(e, err)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to Encode: %w", ErrCompress, err)
+	}
+	if err := gw.w.Close(); err != nil {
+		return nil, fmt.Errorf("%w: failed to gzip Close: %w", ErrCompress, err)
+	}
+
+	res := make([]byte, gw.buf.Len())
+	copy(res, gw.buf.Bytes())
+	return res, nil
+}
+
+// GunzipUnmarshal はGzipMarshalの逆で、dataを展開しながらJSONとしてvに読み込む
+// PoolのgzipReaderからPoolのjsonDecoderで直接読むので、展開したJSONの[]byteを作らない
+func GunzipUnmarshal(data []byte, v any) error {
+	if rv := reflect.ValueOf(v); rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errUnmarshalNotPtr
+	}
+	if len(data) == 0 {
+		return errUnmarshalEmptyData
+	}
+
+	gr := gzipReaderPool.Get().(*gzipReader)
+	if gr.err != nil {
+		return fmt.Errorf("%w: failed to Get gzipReaderPool: %w", ErrDecompress, gr.err)
+	}
+	defer gzipReaderPool.Put(gr)
+	defer gr.in.Reset(nil)
+	defer gr.r.Close()
+	gr.in.Reset(data)
+	if err := gr.r.Reset(&gr.in); err != nil {
+		return fmt.Errorf("%w: failed to Reset gzip Reader: %w", ErrDecompress, err)
+	}
+
+	d := getJSONDecoder(jsonDecoderPool, gr.r)
+	err := d.dec.Decode(v)
+	if err == nil {
+		// Decodeは値を読み終わったところで止まるので、最後まで読んでgzipのCRCと余計なデータがないことを確認する
+		err = expectJSONEOF(d.dec)
+	}
+	putJSONDecoder(d, err)
+	if err != nil {
+		return fmt.Errorf("%w: failed to Decode: %w", ErrDecompress, err)
+	}
+	return nil
+}
+
+// gzipMarshalNaive はjson.MarshalとGzipを順に呼ぶだけのもの。ベンチマークの比較用
+func gzipMarshalNaive(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Gzip(b)
+}
+
+// gunzipUnmarshalNaive はGunzipとjson.Unmarshalを順に呼ぶだけのもの。ベンチマークの比較用
+func gunzipUnmarshalNaive(data []byte, v any) error {
+	b, err := Gunzip(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+type nestedPayload struct {
+	Owner    JsonData          `json:"owner"`
+	Members  []JsonData        `json:"members"`
+	Labels   map[string]string `json:"labels"`
+	Archived *bool             `json:"archived,omitempty"`
+}
+
+func TestGzipMarshal(t *testing.T) {
+	archived := true
+	tests := map[string]struct {
+		in  any
+		out func() any // GunzipUnmarshalで読み込む先
+	}{
+		"JsonData": {
+			in:  JsonData{ID: 1, Name: "Jack", Items: []string{"knife", "shield", "herbs"}},
+			out: func() any { return &JsonData{} },
+		},
+		"nested": {
+			in: nestedPayload{
+				Owner:    JsonData{ID: 1, Name: "Jack"},
+				Members:  []JsonData{{ID: 2, Name: "Jill", Items: []string{"bow"}}, {ID: 3}},
+				Labels:   map[string]string{"team": "red", "region": "tokyo"},
+				Archived: &archived,
+			},
+			out: func() any { return &nestedPayload{} },
+		},
+	}
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		for name, tc := range tests {
+			t.Run(name, func(t *testing.T) {
+				compressed, err := GzipMarshal(tc.in)
+				if err != nil {
+					t.Fatal(err)
+				}
+				out := tc.out()
+				if err := GunzipUnmarshal(compressed, out); err != nil {
+					t.Fatal(err)
+				}
+				if got := reflect.ValueOf(out).Elem().Interface(); !reflect.DeepEqual(got, tc.in) {
+					t.Errorf("got: %+v, want: %+v", got, tc.in)
+				}
+			})
+		}
+	}
+}
+
+func TestGzipMarshalErrors(t *testing.T) {
+	if _, err := GzipMarshal(nil); !errors.Is(err, errMarshalNil) {
+		t.Errorf("nil: got %v, want %v", err, errMarshalNil)
+	}
+	if _, err := GzipMarshal((*JsonData)(nil)); !errors.Is(err, errMarshalNil) {
+		t.Errorf("nil pointer: got %v, want %v", err, errMarshalNil)
+	}
+	var ute *json.UnsupportedTypeError
+	if _, err := GzipMarshal(make(chan int)); !errors.Is(err, ErrCompress) || !errors.As(err, &ute) {
+		t.Errorf("chan: got %v, want ErrCompress wrapping *json.UnsupportedTypeError", err)
+	}
+
+	compressed, err := GzipMarshal(JsonData{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := GunzipUnmarshal(compressed, JsonData{}); !errors.Is(err, errUnmarshalNotPtr) {
+		t.Errorf("non-pointer: got %v, want %v", err, errUnmarshalNotPtr)
+	}
+	if err := GunzipUnmarshal(compressed, (*JsonData)(nil)); !errors.Is(err, errUnmarshalNotPtr) {
+		t.Errorf("nil pointer: got %v, want %v", err, errUnmarshalNotPtr)
+	}
+	if err := GunzipUnmarshal(nil, &JsonData{}); !errors.Is(err, errUnmarshalEmptyData) {
+		t.Errorf("empty data: got %v, want %v", err, errUnmarshalEmptyData)
+	}
+	if err := GunzipUnmarshal([]byte("not gzip"), &JsonData{}); !errors.Is(err, ErrDecompress) {
+		t.Errorf("not gzip: got %v, want %v", err, ErrDecompress)
+	}
+
+	// 値の後ろに余計なデータがある
+	trailing := mustGzip(t, `{"id":1} {"id":2}`)
+	if err := GunzipUnmarshal(trailing, &JsonData{}); !errors.Is(err, errJSONTrailing) {
+		t.Errorf("trailing: got %v, want %v", err, errJSONTrailing)
+	}
+
+	// JSONの型が合わない
+	var n int
+	if err := GunzipUnmarshal(compressed, &n); !errors.Is(err, ErrDecompress) {
+		t.Errorf("type mismatch: got %v, want %v", err, ErrDecompress)
+	}
+}
+
+var (
+	marshalResult   []byte
+	unmarshalResult JsonData
+	marshalInput    = JsonData{ID: 1, Name: "Jack", Items: []string{"knife", "shield", "herbs"}}
+)
+
+func BenchmarkGzipMarshal(b *testing.B) {
+	b.ReportAllocs()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		r, _ = GzipMarshal(marshalInput)
+	}
+	marshalResult = r
+}
+
+func BenchmarkGzipMarshalNaive(b *testing.B) {
+	b.ReportAllocs()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		r, _ = gzipMarshalNaive(marshalInput)
+	}
+	marshalResult = r
+}
+
+func BenchmarkGunzipUnmarshal(b *testing.B) {
+	compressed, _ := GzipMarshal(marshalInput)
+	b.ReportAllocs()
+	b.ResetTimer()
+	var r JsonData
+	for n := 0; n < b.N; n++ {
+		r = JsonData{}
+		GunzipUnmarshal(compressed, &r)
+	}
+	unmarshalResult = r
+}
+
+func BenchmarkGunzipUnmarshalNaive(b *testing.B) {
+	compressed, _ := GzipMarshal(marshalInput)
+	b.ReportAllocs()
+	b.ResetTimer()
+	var r JsonData
+	for n := 0; n < b.N; n++ {
+		r = JsonData{}
+		gunzipUnmarshalNaive(compressed, &r)
+	}
+	unmarshalResult = r
+}
+
+// go test -run XX -bench 'GzipMarshal|GunzipUnmarshal' .
+// BenchmarkGzipMarshal          	  379230	      4698 ns/op	     192 B/op	       3 allocs/op
+// BenchmarkGzipMarshalNaive     	    8547	    146814 ns/op	 1076454 B/op	      20 allocs/op
+// BenchmarkGunzipUnmarshal      	  759979	      1831 ns/op	     112 B/op	       3 allocs/op
+// BenchmarkGunzipUnmarshalNaive 	  132180	      8847 ns/op	   41905 B/op	      11 allocs/op
+// ほとんどの差はgzip.Writer/Readerを毎回作るかどうか
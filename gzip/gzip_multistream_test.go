@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+)
+
+// Poolで使い回すgzipReaderを作る
+// Resetで入力を設定するまで使わないので、EmptyGzipReaderで作っておく
+func newGzipReader() interface{} {
+	r, err := EmptyGzipReader()
+	if err != nil {
+		return &gzipReader{
+			err: err,
+		}
+	}
+	return &gzipReader{
+		r:   r,
+		buf: &bytes.Buffer{},
+	}
+}
+
+// Multistreamを使うかどうかで別々のPoolにする
+// 1つのPoolで混ぜると、前に使った人のMultistreamの設定を引き継いでしまうミスが起きやすい
+var (
+	multistreamGzipReaderPool = &sync.Pool{New: newGzipReader}
+	firstMemberGzipReaderPool = &sync.Pool{New: newGzipReader}
+)
+
+// GunzipMultistream は連結された複数のgzip memberを全て展開する
+func GunzipMultistream(data io.Reader) ([]byte, error) {
+	return gunzipCopy(multistreamGzipReaderPool, nil, data, true)
+}
+
+// GunzipFirstMember は最初のgzip memberだけを展開する
+func GunzipFirstMember(data io.Reader) ([]byte, error) {
+	return gunzipCopy(firstMemberGzipReaderPool, nil, data, false)
+}
+
+func TestGunzipMultistream(t *testing.T) {
+	first, err := Gzip([]byte("hello "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Gzip([]byte("world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	concatenated := append(append([]byte{}, first...), second...)
+
+	// 交互に呼んでも、お互いのMultistreamの設定が混ざらないことを確認する
+	for i := 0; i < 3; i++ {
+		got, err := GunzipMultistream(bytes.NewReader(concatenated))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "hello world" {
+			t.Errorf("GunzipMultistream got: %s, want: %s", got, "hello world")
+		}
+
+		got, err = GunzipFirstMember(bytes.NewReader(concatenated))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "hello " {
+			t.Errorf("GunzipFirstMember got: %s, want: %s", got, "hello ")
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// GzipReaderToBytesのsizeHintが0以下のときに使う圧縮後のサイズの見込み
+const defaultGzipSizeHint = 32 * 1024
+
+// GzipReaderToBytesのsizeHintの上限
+// Content-Lengthのような外から渡された大きな値でPoolのbufを育てると、そのbufがPoolに残り続けるので、ここで切り詰める
+const maxGzipSizeHint = 1 << 20
+
+// GzipReaderToBytes はrから読んだデータをgzipして返す。返り値はPoolのbufからコピーしたもの
+// sizeHintは圧縮後のサイズの見込みで、先にPoolのbufをその大きさまでGrowしておく
+// レスポンスのBodyのように大体の大きさが分かっているときに、圧縮中のbufの再確保を減らせる
+// maxGzipSizeHintより大きいsizeHintはmaxGzipSizeHintとして扱う
+func GzipReaderToBytes(r io.Reader, sizeHint int) ([]byte, error) {
+	if sizeHint <= 0 {
+		sizeHint = defaultGzipSizeHint
+	}
+	sizeHint = min(sizeHint, maxGzipSizeHint)
+	gw := gzipWriterPool.Get().(*gzipWriter)
+	gw.markGet()
+	defer putUnlessPanic(&gzipWriterPool, gw)
+
+	if err := gzipReaderInto(gw, r, sizeHint); err != nil {
+		return nil, err
+	}
+	res := make([]byte, gw.buf.Len())
+	copy(res, gw.buf.Bytes())
+	return res, nil
+}
+
+// gzipReaderInto はgwのbufをsizeHintまでGrowしてから、rから読んだデータをgzipしてgw.bufに書き込む
+// sizeHintが0ならGrowしない
+func gzipReaderInto(gw *gzipWriter, r io.Reader, sizeHint int) error {
+	gw.buf.Reset()
+	gw.w.Reset(gw.buf)
+	gw.buf.Grow(sizeHint)
+
+	src := &errRecordingReader{r: r}
+	if _, err := copyWithPool(gw.w, src); err != nil {
+		if src.err != nil && errors.Is(err, src.err) {
+			return fmt.Errorf("%w: failed to read: %w", ErrRead, err)
+		}
+		return fmt.Errorf("%w: failed to gzip Write: %w", ErrCompress, err)
+	}
+	if err := gw.w.Close(); err != nil {
+		return fmt.Errorf("%w: failed to gzip Close: %w", ErrCompress, err)
+	}
+	return nil
+}
+
+func TestGzipReaderToBytes(t *testing.T) {
+	large := sizedInput(1 << 20)
+	tests := map[string]struct {
+		in       []byte
+		sizeHint int
+	}{
+		"small_default_hint": {in: []byte(data), sizeHint: 0},
+		"large_exact_hint":   {in: large, sizeHint: 300 * 1024},
+		"large_small_hint":   {in: large, sizeHint: 10},
+		// maxGzipSizeHintで切り詰めるので、1TB分のbufを確保しようとしない
+		"huge_hint": {in: []byte(data), sizeHint: 1 << 40},
+		"empty":     {in: nil, sizeHint: 0},
+	}
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		for name, tc := range tests {
+			t.Run(name, func(t *testing.T) {
+				compressed, err := GzipReaderToBytes(bytes.NewReader(tc.in), tc.sizeHint)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := GunzipBytes(compressed)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, tc.in) {
+					t.Errorf("got %d bytes, want %d bytes", len(got), len(tc.in))
+				}
+			})
+		}
+	}
+
+	r := &brokenReader{r: strings.NewReader(data), n: 10}
+	if _, err := GzipReaderToBytes(r, 0); !errors.Is(err, ErrRead) || !errors.Is(err, errBrokenReader) {
+		t.Errorf("got: %v, want %v wrapping %v", err, ErrRead, errBrokenReader)
+	}
+}
+
+// Poolのbufは一度育つと小さくならないので、温まったPoolではsizeHintの有無で差は出ない
+// Poolが空でNewした直後(GCの後など)を再現するため、毎回新しいbufを持たせて比較する
+func benchmarkGzipReaderInto(b *testing.B, sizeHint int) {
+	in := sizedInput(1 << 20)
+	gw := newGzipWriter().(*gzipWriter)
+	var rd bytes.Reader
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		gw.buf = &bytes.Buffer{}
+		rd.Reset(in)
+		if err := gzipReaderInto(gw, &rd, sizeHint); err != nil {
+			b.Fatal(err)
+		}
+	}
+	Result = gw.buf.Bytes()
+}
+
+func BenchmarkGzipReaderIntoNoHint(b *testing.B) {
+	benchmarkGzipReaderInto(b, 0)
+}
+
+func BenchmarkGzipReaderIntoHint(b *testing.B) {
+	// 1MBのsizedInputの圧縮後は256KBほど
+	benchmarkGzipReaderInto(b, 300*1024)
+}
+
+// go test -run XX -bench GzipReaderInto .
+// BenchmarkGzipReaderIntoNoHint 	     146	   8068938 ns/op	  531787 B/op	      14 allocs/op
+// BenchmarkGzipReaderIntoHint   	     148	   8164224 ns/op	  318877 B/op	       3 allocs/op
+// sizeHintなしではbufが倍々に伸びる途中の再確保でallocsとB/opが増える。時間はほとんど圧縮なので変わらない
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+// GzipToTempFile はdataをgzipしながら一時ファイルに書き込み、先頭にSeekしたファイルを返す
+// 圧縮結果をメモリに持たないので、GB単位の大きいデータでもbufが育たない
+// gzip.WriterはWriteGzipToと同じくPoolのgzipWriterNoBufを使う
+// 返したファイルは呼び出し元のもので、使い終わったらCloseしてos.Removeすること
+func GzipToTempFile(data []byte) (*os.File, error) {
+	f, err := os.CreateTemp("", "gzip-*.gz")
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to CreateTemp: %w", ErrCompress, err)
+	}
+	if err := gzipToFile(f, data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+func gzipToFile(f *os.File, data []byte) error {
+	if _, err := WriteGzipTo(f, data); err != nil {
+		return fmt.Errorf("%w: %w", ErrCompress, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("%w: failed to Seek: %w", ErrCompress, err)
+	}
+	return nil
+}
+
+func TestGzipToTempFile(t *testing.T) {
+	large := sizedInput(8 << 20)
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		f, err := GzipToTempFile(large)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			f.Close()
+			os.Remove(f.Name())
+		})
+
+		info, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() == 0 || info.Size() >= int64(len(large)) {
+			t.Errorf("compressed file size: %d, input size: %d", info.Size(), len(large))
+		}
+
+		// Seekしてあるので、そのまま先頭から読める
+		got, err := Gunzip(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, large) {
+			t.Errorf("got %d bytes, want %d bytes", len(got), len(large))
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"io/ioutil"
 	"log"
 	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -96,6 +98,8 @@ func GunzipBufferReadFrom(data io.Reader) ([]byte, error) {
 type gzipWriter struct {
 	w   *gzip.Writer
 	buf *bytes.Buffer
+	// Poolに戻されているかどうか。poolDebugのときに二重Putの検出に使う
+	inPool atomic.Bool
 }
 
 var gzipWriterPool = sync.Pool{
@@ -109,102 +113,115 @@ var gzipWriterPool = sync.Pool{
 	},
 }
 
+// 空データをgzipした結果は毎回同じなので最初に作っておく
+var emptyGzip, _ = Gzip(nil)
+
 func GzipWithGzipWriterPool(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		// 空データのときはPoolのWriterを使わずに作っておいた結果を返す
+		// 呼び出し元に書き換えられないようにコピーして返す
+		res := make([]byte, len(emptyGzip))
+		copy(res, emptyGzip)
+		return res, nil
+	}
+
 	gw := gzipWriterPool.Get().(*gzipWriter)
-	defer gzipWriterPool.Put(gw)
+	gw.markGet()
+	defer putUnlessPanic(&gzipWriterPool, gw)
 	gw.buf.Reset()
 	gw.w.Reset(gw.buf)
 
 	if _, err := gw.w.Write(data); err != nil {
-		return nil, fmt.Errorf("failed to gzip Write: %v", err)
+		return nil, fmt.Errorf("%w: failed to gzip Write: %w", ErrCompress, err)
 	}
 	if err := gw.w.Close(); err != nil {
-		return nil, fmt.Errorf("failed to gzip Close: %v", err)
+		return nil, fmt.Errorf("%w: failed to gzip Close: %w", ErrCompress, err)
 	}
+	gzipRatios.Observe(len(data), gw.buf.Len())
 
 	return gw.buf.Bytes(), nil
 }
 
+// putUnlessPanic はxをpoolに戻す。ただしpanicが起きていたら戻さずにpanicをそのまま伝える
+// panicした時のxは中途半端な状態かもしれないので、Poolに戻すと次に使う人が壊れたものを受け取ってしまう
+// recoverはdeferで直接呼ばれた関数の中でしか効かないので、必ず defer putUnlessPanic(pool, x) の形で使うこと
+// xがputMarkerなら、Putする前にmarkPutで二重Putを確認する
+func putUnlessPanic(pool *sync.Pool, x interface{}) {
+	if r := recover(); r != nil {
+		panic(r)
+	}
+	if m, ok := x.(putMarker); ok {
+		m.markPut()
+	}
+	pool.Put(x)
+}
+
 type gzipReader struct {
 	r   *gzip.Reader
 	buf *bytes.Buffer
 	err error
+	src errRecordingReader // rの読み込み元
+	in  bytes.Reader       // []byteを入力にするときにsrcへ渡すReader
+	// io.Readerを入力にするときにrへ渡すbufio.Reader。gunzipCoreで最初に使うときに作る
+	// gzip.Reader.Resetはio.ByteReaderでないReaderを毎回bufio.NewReaderで包むので、ここで使いまわす
+	br *bufio.Reader
 }
 
 var gzipReaderPool = sync.Pool{
-	New: func() interface{} {
-		var buf bytes.Buffer
-		// 空のbufをgzip.NewReaderで読み込むと EOF を出すので、
-		// gzip header情報を書き込む
-		zw := gzip.NewWriter(&buf)
-		if err := zw.Close(); err != nil {
-			return &gzipReader{
-				err: err,
-			}
-		}
-
-		r, err := gzip.NewReader(&buf)
-		if err != nil {
-			return &gzipReader{
-				err: err,
-			}
-		}
-		return &gzipReader{
-			r:   r,
-			buf: &buf,
-		}
-	},
+	New: newGzipReader,
 }
 
 func GunzipWithGzipReaderPool(data io.Reader) ([]byte, error) {
-	gr := gzipReaderPool.Get().(*gzipReader)
-	if gr.err != nil {
-		return nil, fmt.Errorf("failed to Get gzipReaderPool: %v", gr.err)
-	}
-	defer gzipReaderPool.Put(gr)
-	defer gr.r.Close()
-	gr.buf.Reset()
-	if err := gr.r.Reset(data); err != nil {
+	gr, err := gunzipCore(&gzipReaderPool, nil, data, true)
+	if err != nil {
 		return nil, err
 	}
-
-	if _, err := io.Copy(gr.buf, gr.r); err != nil {
-		return nil, fmt.Errorf("failed to io.Copy: %v", err)
-	}
+	defer putGzipReader(&gzipReaderPool, gr)
 
 	return gr.buf.Bytes(), nil
 }
 
 type GzipperWithSyncPool struct {
-	GzipWriterPool *sync.Pool
+	// ResetPoolで差し替えても使っている途中のGzipと競合しないように、atomic.Pointerで持つ
+	GzipWriterPool atomic.Pointer[DrainablePool]
 }
 
 func NewGzipperWithSyncPool() *GzipperWithSyncPool {
-	return &GzipperWithSyncPool{
-		GzipWriterPool: &sync.Pool{
-			New: func() interface{} {
-				buf := &bytes.Buffer{}
-				w := gzip.NewWriter(buf)
-				return &gzipWriter{
-					w:   w,
-					buf: buf,
-				}
-			},
-		},
-	}
+	g := &GzipperWithSyncPool{}
+	g.GzipWriterPool.Store(newGzipperPool())
+	return g
+}
+
+func newGzipperPool() *DrainablePool {
+	return NewDrainablePool(gzipperPoolSize, func() interface{} {
+		buf := &bytes.Buffer{}
+		w := gzip.NewWriter(buf)
+		return &gzipWriter{
+			w:   w,
+			buf: buf,
+		}
+	})
+}
+
+// Drain はPoolに溜まっているgzipWriterを全て捨てて、捨てた数を返す
+// メモリを早く解放したいときにGCを待たずに呼び出す
+func (g *GzipperWithSyncPool) Drain() int {
+	return g.GzipWriterPool.Load().Drain()
 }
 
 func (g *GzipperWithSyncPool) Gzip(data []byte) ([]byte, error) {
-	gw := g.GzipWriterPool.Get().(*gzipWriter)
-	defer g.GzipWriterPool.Put(gw)
+	// Getした時のPoolに戻す。途中でResetPoolされていたら古いPoolごとGCされる
+	pool := g.GzipWriterPool.Load()
+	gw := pool.Get().(*gzipWriter)
+	defer pool.Put(gw)
 	gw.buf.Reset()
 	gw.w.Reset(gw.buf)
 
 	if _, err := gw.w.Write(data); err != nil {
-		return nil, fmt.Errorf("failed to gzip Write: %v", err)
+		return nil, fmt.Errorf("%w: failed to gzip Write: %w", ErrCompress, err)
 	}
 	if err := gw.w.Close(); err != nil {
-		return nil, fmt.Errorf("failed to gzip Close: %v", err)
+		return nil, fmt.Errorf("%w: failed to gzip Close: %w", ErrCompress, err)
 	}
 
 	return gw.buf.Bytes(), nil
@@ -216,46 +233,16 @@ type GunzipperWithSyncPool struct {
 
 func NewGunzipperWithSyncPool() *GunzipperWithSyncPool {
 	return &GunzipperWithSyncPool{
-		GzipReaderPool: &sync.Pool{
-			New: func() interface{} {
-				var buf bytes.Buffer
-				zw := gzip.NewWriter(&buf)
-				if err := zw.Close(); err != nil {
-					return &gzipReader{
-						err: err,
-					}
-				}
-
-				r, err := gzip.NewReader(&buf)
-				if err != nil {
-					return &gzipReader{
-						err: err,
-					}
-				}
-				return &gzipReader{
-					r:   r,
-					buf: &buf,
-				}
-			},
-		},
+		GzipReaderPool: NewGzipReaderPool(),
 	}
 }
 
 func (g *GunzipperWithSyncPool) Gunzip(data io.Reader) ([]byte, error) {
-	gr := g.GzipReaderPool.Get().(*gzipReader)
-	if gr.err != nil {
-		return nil, fmt.Errorf("failed to Get gzipReaderPool: %v", gr.err)
-	}
-	defer g.GzipReaderPool.Put(gr)
-	defer gr.r.Close()
-	gr.buf.Reset()
-	if err := gr.r.Reset(data); err != nil {
+	gr, err := gunzipCore(g.GzipReaderPool, nil, data, true)
+	if err != nil {
 		return nil, err
 	}
-
-	if _, err := io.Copy(gr.buf, gr.r); err != nil {
-		return nil, fmt.Errorf("failed to io.Copy: %v", err)
-	}
+	defer putGzipReader(g.GzipReaderPool, gr)
 
 	return gr.buf.Bytes(), nil
 }
@@ -344,6 +331,36 @@ Package gzip implements reading and writing of gzip format compressed files, as
 	}
 }
 
+func TestGzipWithGzipWriterPoolEmpty(t *testing.T) {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := b.Bytes()
+
+	for i := 0; i < 2; i++ {
+		res, err := GzipWithGzipWriterPool([]byte{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(res, want) {
+			t.Errorf("got: %v, want: %v", res, want)
+		}
+
+		got, err := Gunzip(bytes.NewBuffer(res))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 0 {
+			t.Errorf("got: %v, want empty", got)
+		}
+
+		// 返り値を書き換えても次の結果に影響しない
+		res[0] = 0
+	}
+}
+
 var (
 	Result []byte
 	data   = `https://pkg.go.dev/compress/gzip
@@ -373,6 +390,55 @@ func BenchmarkGzipWithGzipWriterPool(b *testing.B) {
 	Result = r
 }
 
+// 空データのときはPoolも使わず、返り値のコピーの1 allocだけになる
+func BenchmarkGzipWithGzipWriterPoolEmpty(b *testing.B) {
+	b.ReportAllocs()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		r, _ = GzipWithGzipWriterPool(nil)
+	}
+	Result = r
+}
+
+// 上のベンチマークは1つのgoroutineで順番に呼ぶだけなので、Poolが本来想定している並行の場合を測る
+// Resultに代入するとgoroutine間でraceになるので、goroutineごとの変数に入れて捨てる
+func benchmarkGzipParallel(b *testing.B, gzip func([]byte) ([]byte, error)) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var r []byte
+		for pb.Next() {
+			var err error
+			r, err = gzip([]byte(data))
+			if err != nil {
+				b.Error(err)
+				return
+			}
+		}
+		_ = r
+	})
+}
+
+func BenchmarkGzipParallel(b *testing.B) {
+	benchmarkGzipParallel(b, Gzip)
+}
+
+func BenchmarkGzipWithGzipWriterPoolParallel(b *testing.B) {
+	benchmarkGzipParallel(b, GzipWithGzipWriterPool)
+}
+
+// 1コアのマシンで-cpu 1,4を指定して測った結果
+// $go test -run XX -bench 'Gzip(WithGzipWriterPool)?(Parallel)?$' -cpu 1,4 .
+// BenchmarkGzip                               	   10000	    107189 ns/op	 1076720 B/op	      19 allocs/op
+// BenchmarkGzip-4                             	    2833	    628355 ns/op	 1076727 B/op	      19 allocs/op
+// BenchmarkGzipWithGzipWriterPool             	  202194	      6393 ns/op	     176 B/op	       1 allocs/op
+// BenchmarkGzipWithGzipWriterPool-4           	  163039	      6395 ns/op	     209 B/op	       1 allocs/op
+// BenchmarkGzipParallel                       	    8706	    133496 ns/op	 1076720 B/op	      19 allocs/op
+// BenchmarkGzipParallel-4                     	     663	   1599361 ns/op	 1076734 B/op	      19 allocs/op
+// BenchmarkGzipWithGzipWriterPoolParallel     	  183760	      6789 ns/op	     176 B/op	       1 allocs/op
+// BenchmarkGzipWithGzipWriterPoolParallel-4   	  161014	      6634 ns/op	     209 B/op	       1 allocs/op
+// 順番に呼ぶ場合でもgzip.NewWriterの1MBほどの確保がなくなるので、Poolの効果はすでに大きい
+// 並行にすると、Poolなしは毎回1MBを確保するのでGCが増えて遅くなるが、Poolありはほとんど変わらない
+
 func BenchmarkGzipperWithSyncPool(b *testing.B) {
 	g := NewGzipperWithSyncPool()
 	b.ResetTimer()
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+var ErrGzipVerify = errors.New("gzip round-trip verification failed")
+
+// GzipVerified はGzipした結果をその場でGunzipして、元のデータと一致するか確認してから返す
+// Poolから取ったWriterの状態がおかしい場合などに、壊れたデータを返さないようにするためのもの
+// 圧縮に加えて展開と比較もするので、Gzipの倍以上CPUを使う。大事なデータのときだけ使うこと
+func (g *GzipperWithSyncPool) GzipVerified(data []byte) ([]byte, error) {
+	pool := g.GzipWriterPool.Load()
+	gw := pool.Get().(*gzipWriter)
+	defer pool.Put(gw)
+	gw.buf.Reset()
+	gw.w.Reset(gw.buf)
+
+	if _, err := gw.w.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to gzip Write: %v", err)
+	}
+	if err := gw.w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to gzip Close: %v", err)
+	}
+
+	// gwをPutする前に確認しないと、他のgoroutineにbufを上書きされる可能性がある
+	if err := verifyGzip(gw.buf.Bytes(), data); err != nil {
+		return nil, err
+	}
+
+	res := make([]byte, gw.buf.Len())
+	copy(res, gw.buf.Bytes())
+	return res, nil
+}
+
+// verifyGzip はcompressedを展開した結果がwantと一致するか確認する
+func verifyGzip(compressed, want []byte) error {
+	gr := gzipReaderPool.Get().(*gzipReader)
+	if gr.err != nil {
+		return fmt.Errorf("failed to Get gzipReaderPool: %v", gr.err)
+	}
+	defer gzipReaderPool.Put(gr)
+	defer gr.r.Close()
+	gr.buf.Reset()
+	if err := gr.r.Reset(bytes.NewReader(compressed)); err != nil {
+		return fmt.Errorf("%w: %v", ErrGzipVerify, err)
+	}
+	if _, err := io.Copy(gr.buf, gr.r); err != nil {
+		return fmt.Errorf("%w: %v", ErrGzipVerify, err)
+	}
+	if !bytes.Equal(gr.buf.Bytes(), want) {
+		return fmt.Errorf("%w: decompressed %d bytes, want %d bytes", ErrGzipVerify, gr.buf.Len(), len(want))
+	}
+	return nil
+}
+
+func TestGzipVerified(t *testing.T) {
+	g := NewGzipperWithSyncPool()
+	for i := 0; i < 3; i++ {
+		res, err := g.GzipVerified([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Gunzip(bytes.NewBuffer(res))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Errorf("got: %s, want: %s", string(got), data)
+		}
+	}
+
+	t.Run("mismatch", func(t *testing.T) {
+		compressed, err := Gzip([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := verifyGzip(compressed, []byte("other data")); !errors.Is(err, ErrGzipVerify) {
+			t.Errorf("got: %v, want: %v", err, ErrGzipVerify)
+		}
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		compressed, err := Gzip([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		compressed[len(compressed)/2] ^= 0xff
+		if err := verifyGzip(compressed, []byte(data)); !errors.Is(err, ErrGzipVerify) {
+			t.Errorf("got: %v, want: %v", err, ErrGzipVerify)
+		}
+	})
+}
+
+func BenchmarkGzipperWithSyncPoolVerified(b *testing.B) {
+	g := NewGzipperWithSyncPool()
+	b.ResetTimer()
+	b.ReportAllocs()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		r, _ = g.GzipVerified([]byte(data))
+	}
+	Result = r
+}
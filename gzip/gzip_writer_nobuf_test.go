@@ -0,0 +1,125 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+)
+
+// gzipWriterNoBuf は呼び出し元のio.Writerに直接書き込むストリーミング用のgzipWriter
+// gzipWriterはGzipWithGzipWriterPoolなどで使うbufを持っていて、Poolの中でbufが大きく育つ
+// ストリーミングではbufを使わないのに、同じPoolから取ると育ったbufを持ったまま使うことになるので、
+// bufを持たない別のPoolに分ける
+type gzipWriterNoBuf struct {
+	w *gzip.Writer
+}
+
+var gzipWriterNoBufPool = sync.Pool{
+	New: func() interface{} {
+		return &gzipWriterNoBuf{w: gzip.NewWriter(io.Discard)}
+	},
+}
+
+// getGzipWriterNoBuf はPoolから取ったgzipWriterNoBufをwに向けて返す
+func getGzipWriterNoBuf(w io.Writer) *gzipWriterNoBuf {
+	gw := gzipWriterNoBufPool.Get().(*gzipWriterNoBuf)
+	gw.w.Reset(w)
+	return gw
+}
+
+// putGzipWriterNoBuf はgwをPoolに戻す
+// Poolに戻した後に呼び出し元のWriterを参照し続けないように、io.Discardに向けなおしてからPutする
+func putGzipWriterNoBuf(gw *gzipWriterNoBuf) {
+	gw.w.Reset(io.Discard)
+	gzipWriterNoBufPool.Put(gw)
+}
+
+// writeGzipToWithBufWriter はgzipWriterNoBufを使う前のWriteGzipTo
+// bufを持ったgzipWriterをgzipWriterPoolから取ってwに向けなおす。ベンチマークの比較用
+func writeGzipToWithBufWriter(w io.Writer, data []byte) (int64, error) {
+	gw := gzipWriterPool.Get().(*gzipWriter)
+	defer gzipWriterPool.Put(gw)
+	defer func() {
+		gw.buf.Reset()
+		gw.w.Reset(gw.buf)
+	}()
+
+	cw := &countingWriter{w: w}
+	gw.w.Reset(cw)
+	if _, err := gw.w.Write(data); err != nil {
+		return cw.n, fmt.Errorf("failed to gzip Write: %v", err)
+	}
+	if err := gw.w.Close(); err != nil {
+		return cw.n, fmt.Errorf("failed to gzip Close: %v", err)
+	}
+	return cw.n, nil
+}
+
+func TestGzipWriterNoBufDetached(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		var dst countingWriter
+		dst.w = io.Discard
+		gw := getGzipWriterNoBuf(&dst)
+		if _, err := gw.w.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		if err := gw.w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		n := dst.n
+		putGzipWriterNoBuf(gw)
+
+		// Poolに戻した後に書き込んでも、前の書き込み先には届かない
+		gw.w.Write([]byte("other data"))
+		gw.w.Close()
+		if dst.n != n {
+			t.Errorf("pooled writer still references dst: %d bytes, want %d", dst.n, n)
+		}
+	}
+}
+
+var streamingResult int64
+
+// ストリーミングの前にGzipWithGzipWriterPoolで大きいデータをgzipしておき、
+// ストリーミングで使うWriterが抱えているbufの大きさをretained-B/opとして出す
+// StreamGzipperのようにコネクションの間Writerを持ち続けると、その間このbufは他で使えない
+func benchmarkStreamingRetained(b *testing.B, retained func() int, write func(w io.Writer, data []byte) (int64, error)) {
+	if _, err := GzipWithGzipWriterPool(sizedInput(1 << 20)); err != nil {
+		b.Fatal(err)
+	}
+	r := retained()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	var n int64
+	for i := 0; i < b.N; i++ {
+		var err error
+		n, err = write(io.Discard, []byte(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(r), "retained-B/op")
+	streamingResult = n
+}
+
+func BenchmarkStreamingGzipWriter(b *testing.B) {
+	b.Run("BufWriter", func(b *testing.B) {
+		benchmarkStreamingRetained(b, func() int {
+			// 次のGetで取り出されるWriterのbufの大きさ
+			gw := gzipWriterPool.Get().(*gzipWriter)
+			defer gzipWriterPool.Put(gw)
+			return gw.buf.Cap()
+		}, writeGzipToWithBufWriter)
+	})
+	b.Run("NoBuf", func(b *testing.B) {
+		benchmarkStreamingRetained(b, func() int { return 0 }, WriteGzipTo)
+	})
+}
+
+// go test -run XX -bench StreamingGzipWriter -cpu 4 .
+// BenchmarkStreamingGzipWriter/BufWriter-4         	  181267	      9054 ns/op	    262144 retained-B/op	     241 B/op	       2 allocs/op
+// BenchmarkStreamingGzipWriter/NoBuf-4             	  167746	      9741 ns/op	         0 retained-B/op	     257 B/op	       2 allocs/op
+// 速さとallocsは変わらないが、BufWriterは使わない256KBのbufを持ったまま書き込んでいる
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// GzipInto はdataをgzipした結果をdstの後ろに追加して返す
+// Gzipの返り値はPoolのgzipWriterのbufそのものなので、次の呼び出しで書き換わってしまう
+// GzipIntoはPutする前にdstへ追加するので、返り値がPoolのメモリを参照することはない
+// dstのcapが十分あれば、呼び出しごとのアロケーションも発生しない
+func (g *GzipperWithSyncPool) GzipInto(dst []byte, data []byte) ([]byte, error) {
+	pool := g.GzipWriterPool.Load()
+	gw := pool.Get().(*gzipWriter)
+	defer pool.Put(gw)
+	gw.buf.Reset()
+	gw.w.Reset(gw.buf)
+
+	if _, err := gw.w.Write(data); err != nil {
+		return dst, fmt.Errorf("%w: failed to gzip Write: %w", ErrCompress, err)
+	}
+	if err := gw.w.Close(); err != nil {
+		return dst, fmt.Errorf("%w: failed to gzip Close: %w", ErrCompress, err)
+	}
+
+	return append(dst, gw.buf.Bytes()...), nil
+}
+
+func TestGzipperWithSyncPoolGzipInto(t *testing.T) {
+	g := NewGzipperWithSyncPool()
+	prefix := []byte("prefix")
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		first, err := g.GzipInto(append([]byte{}, prefix...), []byte("first"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 次の呼び出しで同じgzipWriterが使われても、firstは書き換わらない
+		if _, err := g.GzipInto(nil, []byte("second")); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(first, prefix) {
+			t.Fatalf("prefix was lost: %q", first[:len(prefix)])
+		}
+		got, err := GunzipBytes(first[len(prefix):])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "first" {
+			t.Errorf("got: %s, want: %s", got, "first")
+		}
+	}
+}
+
+func TestGzipperWithSyncPoolGzipIntoAllocs(t *testing.T) {
+	// DrainablePoolはchannelで実装していてGCやraceで値が消えないので、raceでもSkipしない
+	g := NewGzipperWithSyncPool()
+	in := []byte(data)
+	dst, err := g.GzipInto(nil, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		dst, err = g.GzipInto(dst[:0], in)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("allocs: %v, want: 0", allocs)
+	}
+	got, err := GunzipBytes(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Errorf("got: %s, want: %s", got, data)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var ErrValueTooLong = errors.New("value too long")
+
+// MaxHeaderValueLen はEncodeHeaderValue/DecodeHeaderValueが扱う値の最大の長さ
+// HTTPサーバーはヘッダ全体の大きさに上限を持っていることが多い(net/httpは1MB、nginxは既定で8KB)ので、
+// それより小さくしておく
+var MaxHeaderValueLen = 4096
+
+// EncodeHeaderValue はdataをgzipしてからURLで使えるbase64(パディングなし)にする
+// 圧縮したメタデータをHTTPヘッダで渡すときに使う。結果がMaxHeaderValueLenを超えたらErrValueTooLongを返す
+func EncodeHeaderValue(data []byte) (string, error) {
+	return encodeGzipBase64(base64.RawURLEncoding, data, MaxHeaderValueLen)
+}
+
+// DecodeHeaderValue はEncodeHeaderValueで作った値を元のデータに戻す
+// 長さがMaxHeaderValueLenを超えた値は展開せずにErrValueTooLongを返す
+func DecodeHeaderValue(s string) ([]byte, error) {
+	if len(s) > MaxHeaderValueLen {
+		return nil, fmt.Errorf("%w: length %d exceeds %d", ErrValueTooLong, len(s), MaxHeaderValueLen)
+	}
+	return decodeGzipBase64(base64.RawURLEncoding, s)
+}
+
+func TestHeaderValue(t *testing.T) {
+	inputs := [][]byte{[]byte(data), {}, []byte(`{"trace_id":"abc","tags":["a","b"]}`)}
+
+	for i := 0; i < 2; i++ {
+		for _, in := range inputs {
+			s, err := EncodeHeaderValue(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// ヘッダにそのまま入れられる文字だけになっている
+			if strings.ContainsAny(s, "+/=") {
+				t.Errorf("got %q, want URL-safe base64 without padding", s)
+			}
+			got, err := DecodeHeaderValue(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, in) {
+				t.Errorf("got %d bytes, want %d bytes", len(got), len(in))
+			}
+		}
+	}
+}
+
+func TestHeaderValueTooLong(t *testing.T) {
+	defer func(n int) { MaxHeaderValueLen = n }(MaxHeaderValueLen)
+	MaxHeaderValueLen = 64
+
+	// ランダムな単語を並べた1KBは、圧縮してbase64にしても64文字より長い
+	if _, err := EncodeHeaderValue(sizedInput(1024)); !errors.Is(err, ErrValueTooLong) {
+		t.Errorf("EncodeHeaderValue: got %v, want %v", err, ErrValueTooLong)
+	}
+	if _, err := DecodeHeaderValue(strings.Repeat("A", 65)); !errors.Is(err, ErrValueTooLong) {
+		t.Errorf("DecodeHeaderValue: got %v, want %v", err, ErrValueTooLong)
+	}
+
+	// 上限以下なら使える
+	s, err := EncodeHeaderValue([]byte("ok"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := DecodeHeaderValue(s); err != nil || string(got) != "ok" {
+		t.Errorf("got %q, %v, want %q", got, err, "ok")
+	}
+}
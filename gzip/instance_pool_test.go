@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+// gzipReaderPoolなどのパッケージ変数のPoolはプロセス全体で共有されるので、
+// あるライブラリが大きなデータを扱うと、伸びたbufが関係ない別の呼び出し元にも回ってくる
+// 下のコンストラクタで自分専用のPoolを作れば、他の呼び出し元とPoolを分けられる
+
+// NewGzipReaderPool はgzipReaderの新しいPoolを返す。gzipReaderPoolとは共有しない
+func NewGzipReaderPool() *sync.Pool {
+	return &sync.Pool{
+		New: newGzipReader,
+	}
+}
+
+// NewBufferPool はbytes.Bufferの新しいPoolを返す
+func NewBufferPool() *sync.Pool {
+	return &sync.Pool{
+		New: func() interface{} {
+			return &bytes.Buffer{}
+		},
+	}
+}
+
+func TestInstancePoolsNotShared(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+
+	t.Run("BufferPool", func(t *testing.T) {
+		a, b := NewBufferPool(), NewBufferPool()
+		buf := a.Get().(*bytes.Buffer)
+		buf.WriteString("a's data")
+		a.Put(buf)
+
+		if got := b.Get().(*bytes.Buffer); got == buf {
+			t.Error("got a's buffer from b")
+		}
+		if got := a.Get().(*bytes.Buffer); got != buf {
+			t.Error("want a's buffer back from a")
+		}
+	})
+
+	t.Run("GzipReaderPool", func(t *testing.T) {
+		a, b := NewGzipReaderPool(), NewGzipReaderPool()
+		gr := a.Get().(*gzipReader)
+		a.Put(gr)
+
+		if got := b.Get().(*gzipReader); got == gr {
+			t.Error("got a's gzipReader from b")
+		}
+		if got := gzipReaderPool.Get().(*gzipReader); got == gr {
+			t.Error("got a's gzipReader from the global gzipReaderPool")
+		}
+		if got := a.Get().(*gzipReader); got != gr {
+			t.Error("want a's gzipReader back from a")
+		}
+	})
+
+	t.Run("GunzipperWithSyncPool", func(t *testing.T) {
+		compressed, err := Gzip([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, b := NewGunzipperWithSyncPool(), NewGunzipperWithSyncPool()
+		resA, err := a.Gunzip(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Gunzipの返り値はPoolのbufを参照しているので、同じPoolを使っていればbの呼び出しで書き換えられる
+		if _, err := b.Gunzip(bytes.NewReader(mustGzip(t, "b's data"))); err != nil {
+			t.Fatal(err)
+		}
+		if string(resA) != data {
+			t.Errorf("a's result was overwritten by b: %s", resA)
+		}
+	})
+}
+
+func mustGzip(t *testing.T, s string) []byte {
+	t.Helper()
+	res, err := Gzip([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// gzipのmagic number(ID1, ID2)と、圧縮方式(CM)のdeflate
+const (
+	gzipID1     = 0x1f
+	gzipID2     = 0x8b
+	gzipDeflate = 8
+)
+
+// IsGzip はdataがgzipの先頭のバイト列で始まっているかを返す
+func IsGzip(data []byte) bool {
+	return len(data) >= 3 && data[0] == gzipID1 && data[1] == gzipID2 && data[2] == gzipDeflate
+}
+
+// GunzipIfCompressed はdataがgzipなら展開し、そうでなければdataをそのまま返す
+func GunzipIfCompressed(data []byte) ([]byte, error) {
+	if !IsGzip(data) {
+		return data, nil
+	}
+	return GunzipMultistream(bytes.NewReader(data))
+}
+
+func TestGunzipIfCompressed(t *testing.T) {
+	compressed, err := Gzip([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		in     []byte
+		isGzip bool
+		want   []byte
+	}{
+		"gzipped": {
+			in:     compressed,
+			isGzip: true,
+			want:   []byte(data),
+		},
+		"plain_text": {
+			in:     []byte(data),
+			isGzip: false,
+			want:   []byte(data),
+		},
+		"short": {
+			in:     []byte{gzipID1},
+			isGzip: false,
+			want:   []byte{gzipID1},
+		},
+		"magic_only": {
+			in:     []byte{gzipID1, gzipID2},
+			isGzip: false,
+			want:   []byte{gzipID1, gzipID2},
+		},
+		"empty": {
+			in:     []byte{},
+			isGzip: false,
+			want:   []byte{},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := IsGzip(tt.in); got != tt.isGzip {
+				t.Errorf("IsGzip: %v, want: %v", got, tt.isGzip)
+			}
+			got, err := GunzipIfCompressed(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got: %s, want: %s", got, tt.want)
+			}
+		})
+	}
+}
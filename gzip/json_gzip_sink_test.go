@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var (
+	errJSONGzipSinkClosed = errors.New("JSONGzipSink is already closed")
+	errInvalidLineEnding  = errors.New(`line ending must be "\n" or "\r\n"`)
+)
+
+// NDJSONOptions はNDJSONの書き出しの設定
+type NDJSONOptions struct {
+	// LineEnding は行の区切り。"\n"か"\r\n"で、空なら"\n"になる
+	// Windowsのツールで読む場合などに"\r\n"にする
+	LineEnding string
+}
+
+func (o NDJSONOptions) lineEnding() (string, error) {
+	switch o.LineEnding {
+	case "", "\n":
+		return "\n", nil
+	case "\r\n":
+		return "\r\n", nil
+	default:
+		return "", fmt.Errorf("%w: got %q", errInvalidLineEnding, o.LineEnding)
+	}
+}
+
+// lineEndingWriter は書き込むデータの改行をlineEndingに置き換えてwに書き込む
+// json.Encoderは文字列の中の改行を\nにエスケープするので、そのままの改行はEncodeが最後に付けたものだけになる
+type lineEndingWriter struct {
+	w          io.Writer
+	lineEnding string
+}
+
+// Write はpのうち書き込めたバイト数を返す。pの'\n'は、置き換えたlineEndingを全て書けたときだけ1バイトとして数える
+func (l *lineEndingWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			n, err := l.w.Write(p)
+			return written + n, err
+		}
+		n, err := l.w.Write(p[:i])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if _, err := io.WriteString(l.w, l.lineEnding); err != nil {
+			return written, err
+		}
+		written++
+		p = p[i+1:]
+	}
+	return written, nil
+}
+
+// JSONGzipSink は複数のJsonDataをNDJSON(1行に1つのJSON)にして、1つのgzipにまとめる
+// ログの送信などで、レコードごとにgzipするより圧縮が効く
+// PoolのgzipWriterをCloseするまで持ち続ける。並行に使うことはできない
+type JSONGzipSink struct {
+	gw *gzipWriter
+	// 行の区切りが"\r\n"のときだけ使う。Writeのたびに作らないように持っておく
+	lw *lineEndingWriter
+}
+
+func NewJSONGzipSink() *JSONGzipSink {
+	s, _ := NewJSONGzipSinkWithOptions(NDJSONOptions{})
+	return s
+}
+
+// NewJSONGzipSinkWithOptions はoptsの設定でNDJSONを書き出すJSONGzipSinkを返す
+func NewJSONGzipSinkWithOptions(opts NDJSONOptions) (*JSONGzipSink, error) {
+	lineEnding, err := opts.lineEnding()
+	if err != nil {
+		return nil, err
+	}
+	gw := gzipWriterPool.Get().(*gzipWriter)
+	gw.markGet()
+	gw.buf.Reset()
+	gw.w.Reset(gw.buf)
+	s := &JSONGzipSink{gw: gw}
+	if lineEnding != "\n" {
+		s.lw = &lineEndingWriter{w: gw.w, lineEnding: lineEnding}
+	}
+	return s, nil
+}
+
+// Write はinをJSONにして改行を付けて書き込む
+// json.Encoder.Encodeが最後に改行を付けるので、そのままNDJSONの1行になる
+func (s *JSONGzipSink) Write(in JsonData) error {
+	if s.gw == nil {
+		return errJSONGzipSinkClosed
+	}
+	var w io.Writer = s.gw.w
+	if s.lw != nil {
+		w = s.lw
+	}
+	e := getJSONEncoder(w)
+	err := e.enc.Encode(in)
+	putJSONEncoder(e, err)
+	if err != nil {
+		return fmt.Errorf("%w: failed to Encode: %w", ErrCompress, err)
+	}
+	return nil
+}
+
+// Close はgzipのフッタを書き込んで、出来上がったgzipを返す
+// 返り値はPoolのbufからコピーしたもの。gzipWriterはPoolに戻す
+func (s *JSONGzipSink) Close() ([]byte, error) {
+	if s.gw == nil {
+		return nil, errJSONGzipSinkClosed
+	}
+	gw := s.gw
+	s.gw, s.lw = nil, nil
+	defer putUnlessPanic(&gzipWriterPool, gw)
+
+	if err := gw.w.Close(); err != nil {
+		return nil, fmt.Errorf("%w: failed to gzip Close: %w", ErrCompress, err)
+	}
+
+	res := make([]byte, gw.buf.Len())
+	copy(res, gw.buf.Bytes())
+	return res, nil
+}
+
+// DecodeNDJSONStream はrのNDJSONを最後まで読んでJsonDataのSliceにする
+func DecodeNDJSONStream(r io.Reader) ([]JsonData, error) {
+	d := getJSONDecoder(jsonDecoderPool, r)
+	var res []JsonData
+	for {
+		more, err := d.moreInput()
+		if err != nil {
+			putJSONDecoder(d, err)
+			return nil, fmt.Errorf("%w: failed to read: %w", ErrDecompress, err)
+		}
+		if !more {
+			// moreInputで終わりを確かめたのでDecoderはio.EOFを保持しておらず、Poolに戻せる
+			putJSONDecoder(d, nil)
+			return res, nil
+		}
+		var v JsonData
+		if err := d.dec.Decode(&v); err != nil {
+			putJSONDecoder(d, err)
+			return nil, fmt.Errorf("%w: failed to Decode: %w", ErrDecompress, err)
+		}
+		res = append(res, v)
+	}
+}
+
+func TestJSONGzipSink(t *testing.T) {
+	records := []JsonData{
+		{ID: 1, Name: "Jack", Items: []string{"knife", "shield", "herbs"}},
+		{ID: 2, Name: "Jill", Items: []string{"bow"}},
+		{ID: 3, Name: "Bob"},
+	}
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		s := NewJSONGzipSink()
+		for _, r := range records {
+			if err := s.Write(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		compressed, err := s.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decompressed, err := Gunzip(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := bytes.Count(decompressed, []byte("\n")); n != len(records) {
+			t.Errorf("got %d lines, want %d: %s", n, len(records), decompressed)
+		}
+
+		got, err := DecodeNDJSONStream(bytes.NewReader(decompressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, records) {
+			t.Errorf("got: %v, want: %v", got, records)
+		}
+
+		if err := s.Write(records[0]); !errors.Is(err, errJSONGzipSinkClosed) {
+			t.Errorf("Write after Close: got %v, want %v", err, errJSONGzipSinkClosed)
+		}
+		if _, err := s.Close(); !errors.Is(err, errJSONGzipSinkClosed) {
+			t.Errorf("second Close: got %v, want %v", err, errJSONGzipSinkClosed)
+		}
+	}
+
+	// 何も書き込まなくても空のgzipになる
+	compressed, err := NewJSONGzipSink().Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressed, err := Gunzip(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeNDJSONStream(bytes.NewReader(decompressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got: %v, want no records", got)
+	}
+}
+
+func TestJSONGzipSinkLineEnding(t *testing.T) {
+	records := []JsonData{
+		{ID: 1, Name: "Jack", Items: []string{"knife", "shield", "herbs"}},
+		// 文字列の中の改行はエスケープされるので、区切りの置き換えの対象にならない
+		{ID: 2, Name: "Jill\nJane"},
+	}
+	write := func(opts NDJSONOptions) []byte {
+		t.Helper()
+		s, err := NewJSONGzipSinkWithOptions(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range records {
+			if err := s.Write(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		compressed, err := s.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decompressed, err := Gunzip(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append([]byte{}, decompressed...)
+	}
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		lf := write(NDJSONOptions{})
+		crlf := write(NDJSONOptions{LineEnding: "\r\n"})
+		if bytes.Contains(lf, []byte("\r")) {
+			t.Errorf("default output contains \\r: %q", lf)
+		}
+		if want := bytes.ReplaceAll(lf, []byte("\n"), []byte("\r\n")); !bytes.Equal(crlf, want) {
+			t.Errorf("got: %q, want: %q", crlf, want)
+		}
+		if n := bytes.Count(crlf, []byte("\r\n")); n != len(records) {
+			t.Errorf("got %d lines, want %d: %q", n, len(records), crlf)
+		}
+
+		// json.Decoderは\rを空白として読み飛ばすので、どちらの区切りでも同じように読める
+		for name, in := range map[string][]byte{"lf": lf, "crlf": crlf} {
+			got, err := DecodeNDJSONStream(bytes.NewReader(in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, records) {
+				t.Errorf("%s: got: %v, want: %v", name, got, records)
+			}
+		}
+	}
+
+	if _, err := NewJSONGzipSinkWithOptions(NDJSONOptions{LineEnding: "\r"}); !errors.Is(err, errInvalidLineEnding) {
+		t.Errorf("got: %v, want: %v", err, errInvalidLineEnding)
+	}
+}
+
+func TestDecodeNDJSONStreamReusesDecoder(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	newFunc := jsonDecoderPool.New
+	defer func() { jsonDecoderPool.New = newFunc }()
+	news := 0
+	jsonDecoderPool.New = func() interface{} {
+		news++
+		return newFunc()
+	}
+
+	in := "{\"id\":1,\"name\":\"Jack\"}\n{\"id\":2,\"name\":\"Jill\"}\n\n"
+	for i := 0; i < 3; i++ {
+		got, err := DecodeNDJSONStream(strings.NewReader(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || got[1].Name != "Jill" {
+			t.Errorf("got: %v", got)
+		}
+	}
+	// 読み切ったDecoderもPoolに戻るので、Newは最初の1回だけ
+	if news > 1 {
+		t.Errorf("jsonDecoderPool.New was called %d times, want <= 1", news)
+	}
+}
+
+func TestLineEndingWriterPartialWrite(t *testing.T) {
+	in := []byte("ab\ncd\n")
+	tests := map[string]struct {
+		limit int // 書き込み先が書けるバイト数
+		want  int
+	}{
+		"nothing":        {limit: 0, want: 0},
+		"in_first_line":  {limit: 1, want: 1},
+		"in_line_ending": {limit: 3, want: 2},
+		"after_line_end": {limit: 4, want: 3},
+		"in_last_ending": {limit: 7, want: 5},
+		"everything":     {limit: 8, want: len(in)},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			l := &lineEndingWriter{w: &brokenWriter{n: tc.limit}, lineEnding: "\r\n"}
+			n, err := l.Write(in)
+			if n != tc.want {
+				t.Errorf("n: %d, want: %d", n, tc.want)
+			}
+			if wantErr := tc.want < len(in); wantErr != errors.Is(err, errBrokenWriter) {
+				t.Errorf("err: %v, want error: %v", err, wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestPutUnlessPanic(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	newCount := 0
+	pool := &sync.Pool{
+		New: func() interface{} {
+			newCount++
+			return new(int)
+		},
+	}
+
+	use := func(shouldPanic bool) {
+		x := pool.Get()
+		defer putUnlessPanic(pool, x)
+		if shouldPanic {
+			panic("panic")
+		}
+	}
+
+	use(false)
+	use(false)
+	// panicしなければPoolに戻るので、Newは最初の1回だけ
+	if newCount != 1 {
+		t.Errorf("newCount: %d, want: %d", newCount, 1)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != "panic" {
+				t.Errorf("recovered: %v, want: %v", r, "panic")
+			}
+		}()
+		use(true)
+	}()
+	// panicしたものはPoolに戻らないので、次のGetでNewが呼ばれる
+	use(false)
+	if newCount != 2 {
+		t.Errorf("newCount: %d, want: %d", newCount, 2)
+	}
+}
+
+func TestGzipWithGzipWriterPoolPanic(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	// 壊れたgzipWriter(wがnil)をPoolに入れておくと、GzipWithGzipWriterPoolはpanicする
+	// 先にGetしてPoolのprivateを空にしておかないと、次のGetで別のgzipWriterが返ってくる
+	gzipWriterPool.Get()
+	broken := &gzipWriter{buf: &bytes.Buffer{}}
+	gzipWriterPool.Put(broken)
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("want panic")
+			}
+		}()
+		GzipWithGzipWriterPool([]byte(data))
+	}()
+
+	// panicした壊れたgzipWriterはPoolに戻らない
+	gw := gzipWriterPool.Get().(*gzipWriter)
+	if gw == broken {
+		t.Fatal("broken gzipWriter was returned to the pool after panic")
+	}
+	gzipWriterPool.Put(gw)
+
+	res, err := GzipWithGzipWriterPool([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Gunzip(bytes.NewReader(res))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Errorf("got: %s, want: %s", string(got), data)
+	}
+}
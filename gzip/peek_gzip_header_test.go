@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// PeekGzipHeader はdataのgzip headerだけを読んで返す
+// gzip.Reader.Resetはheaderをその場で読むので、本体は展開せずにName/Commentなどを確認できる
+// 展開する前にheaderを見て振り分けたいときに使う
+func PeekGzipHeader(data []byte) (gzip.Header, error) {
+	gr := gzipReaderPool.Get().(*gzipReader)
+	if gr.err != nil {
+		return gzip.Header{}, fmt.Errorf("%w: failed to Get gzipReaderPool: %w", ErrDecompress, gr.err)
+	}
+	defer gzipReaderPool.Put(gr)
+	defer gr.in.Reset(nil) // 呼び出し元のdataを参照し続けないようにする
+	gr.in.Reset(data)
+	if err := gr.r.Reset(&gr.in); err != nil {
+		return gzip.Header{}, fmt.Errorf("%w: failed to Reset gzip Reader: %w", ErrDecompress, err)
+	}
+
+	h := gr.r.Header
+	// ExtraはgzipReaderが持っているSliceなので、コピーして返す
+	if h.Extra != nil {
+		h.Extra = append([]byte(nil), h.Extra...)
+	}
+	return h, nil
+}
+
+func TestPeekGzipHeader(t *testing.T) {
+	want := gzip.Header{
+		Name:    "payload.json",
+		Comment: "route=users",
+		Extra:   []byte("extra"),
+		ModTime: time.Unix(1136214245, 0),
+		OS:      3,
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Header = want
+	zw.Write(bytes.Repeat([]byte(data), 100))
+	zw.Close()
+	compressed := buf.Bytes()
+
+	// headerの後ろの本体を壊しておく。本体まで展開するとエラーになるので、headerだけを読んでいることが分かる
+	broken := append([]byte(nil), compressed[:len(compressed)/2]...)
+	if _, err := Gunzip(bytes.NewReader(broken)); err == nil {
+		t.Fatal("want error when decompressing a truncated payload")
+	}
+
+	for i := 0; i < 2; i++ {
+		for name, in := range map[string][]byte{"full": compressed, "truncated_body": broken} {
+			t.Run(name, func(t *testing.T) {
+				got, err := PeekGzipHeader(in)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Name != want.Name || got.Comment != want.Comment || !bytes.Equal(got.Extra, want.Extra) ||
+					!got.ModTime.Equal(want.ModTime) || got.OS != want.OS {
+					t.Errorf("got: %+v, want: %+v", got, want)
+				}
+			})
+		}
+	}
+
+	if _, err := PeekGzipHeader([]byte("not gzip")); err == nil {
+		t.Error("want error for non-gzip input")
+	}
+
+	// headerだけ読んでPoolに戻したReaderでも、次の展開は正しくできる
+	got, err := GunzipWithGzipReaderPool(bytes.NewReader(gzippedData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Errorf("got: %s, want: %s", string(got), data)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// gzipWriterPoolから取ったgwでinをgzipする
+func gzipWithGzipWriter(gw *gzipWriter, in []byte) {
+	gw.buf.Reset()
+	gw.w.Reset(gw.buf)
+	gw.w.Write(in)
+	gw.w.Close()
+}
+
+// 同じgoroutineでGetとPutをする場合
+// sync.PoolはP(GOMAXPROCSの単位)ごとに値を持っているので、同じPでGetとPutをすれば速い
+func BenchmarkGzipWriterPoolSameGoroutine(b *testing.B) {
+	in := []byte(data)
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		gw := gzipWriterPool.Get().(*gzipWriter)
+		gzipWithGzipWriter(gw, in)
+		gzipWriterPool.Put(gw)
+	}
+}
+
+// Getするgoroutineと、Putするgoroutineが別の場合
+// Putした値はPutしたPに入るので、Getする側は自分のPに値がなく、他のPから取ってくるかNewすることになる
+func BenchmarkGzipWriterPoolCrossGoroutine(b *testing.B) {
+	in := []byte(data)
+	ch := make(chan *gzipWriter, 1)
+	go func() {
+		defer close(ch)
+		for n := 0; n < b.N; n++ {
+			ch <- gzipWriterPool.Get().(*gzipWriter)
+		}
+	}()
+
+	b.ReportAllocs()
+	for gw := range ch {
+		gzipWithGzipWriter(gw, in)
+		gzipWriterPool.Put(gw)
+	}
+}
+
+func TestGzipWriterPoolContention(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip benchmark in short mode")
+	}
+	fmt.Printf("GOMAXPROCS: %d\n", runtime.GOMAXPROCS(0))
+	same := testing.Benchmark(BenchmarkGzipWriterPoolSameGoroutine)
+	fmt.Printf("SameGoroutine:  %s %s\n", same.String(), same.MemString())
+	cross := testing.Benchmark(BenchmarkGzipWriterPoolCrossGoroutine)
+	fmt.Printf("CrossGoroutine: %s %s\n", cross.String(), cross.MemString())
+}
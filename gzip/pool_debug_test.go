@@ -0,0 +1,6 @@
+//go:build pooldebug
+
+package main
+
+// go test -tags pooldebug で実行したときだけ、Poolの使い方の誤りを検出する
+var poolDebug = true
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	// 圧縮率を0.01刻みのbucketで数える
+	ratioBucketsPerUnit = 100
+	// 圧縮率が2以上のものは最後のbucketにまとめる
+	// 小さいデータはheaderの分だけ元より大きくなることがある
+	maxRatioBuckets = 2*ratioBucketsPerUnit + 1
+)
+
+// RatioCollector はgzipの圧縮率(圧縮後のサイズ/元のサイズ)の分布を集計する
+// 複数のgoroutineから同時にObserveしてもよい
+type RatioCollector struct {
+	buckets [maxRatioBuckets]uint64
+}
+
+// GzipWithGzipWriterPoolの圧縮率を集計する
+var gzipRatios = &RatioCollector{}
+
+// Observe は元のサイズinSizeと圧縮後のサイズoutSizeを記録する
+func (c *RatioCollector) Observe(inSize, outSize int) {
+	if inSize <= 0 {
+		return
+	}
+	i := outSize * ratioBucketsPerUnit / inSize
+	if i >= maxRatioBuckets {
+		i = maxRatioBuckets - 1
+	}
+	atomic.AddUint64(&c.buckets[i], 1)
+}
+
+// Percentile はp(0-100)パーセンタイルの圧縮率を返す
+// bucketの上限の値を返すので、0.01の誤差がある。まだ何も記録していないときは0を返す
+func (c *RatioCollector) Percentile(p float64) float64 {
+	var counts [maxRatioBuckets]uint64
+	var total uint64
+	for i := range c.buckets {
+		counts[i] = atomic.LoadUint64(&c.buckets[i])
+		total += counts[i]
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(p / 100 * float64(total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var cum uint64
+	for i, n := range counts {
+		cum += n
+		if cum >= rank {
+			return float64(i+1) / ratioBucketsPerUnit
+		}
+	}
+	return float64(maxRatioBuckets) / ratioBucketsPerUnit
+}
+
+// Reset は集計結果を消す。テストで前の結果の影響を受けないようにするため
+func (c *RatioCollector) Reset() {
+	for i := range c.buckets {
+		atomic.StoreUint64(&c.buckets[i], 0)
+	}
+}
+
+func TestRatioCollector(t *testing.T) {
+	c := &RatioCollector{}
+	if got := c.Percentile(50); got != 0 {
+		t.Errorf("empty Percentile: %v, want: 0", got)
+	}
+
+	// 圧縮率0.2が50個、0.5が40個、0.9が10個
+	var wg sync.WaitGroup
+	observe := func(n, in, out int) {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			c.Observe(in, out)
+		}
+	}
+	wg.Add(3)
+	go observe(50, 1000, 200)
+	go observe(40, 1000, 500)
+	go observe(10, 1000, 900)
+	wg.Wait()
+
+	tests := []struct {
+		p    float64
+		want float64
+	}{
+		{p: 0, want: 0.21},
+		{p: 50, want: 0.21},
+		{p: 51, want: 0.51},
+		{p: 90, want: 0.51},
+		{p: 99, want: 0.91},
+		{p: 100, want: 0.91},
+	}
+	for _, tt := range tests {
+		if got := c.Percentile(tt.p); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Percentile(%v): %v, want: %v", tt.p, got, tt.want)
+		}
+	}
+
+	// 圧縮後の方が大きいものは最後のbucketに入る
+	c.Reset()
+	c.Observe(10, 100)
+	if got, want := c.Percentile(100), float64(maxRatioBuckets)/ratioBucketsPerUnit; got != want {
+		t.Errorf("Percentile(100): %v, want: %v", got, want)
+	}
+
+	c.Reset()
+	if got := c.Percentile(50); got != 0 {
+		t.Errorf("Percentile after Reset: %v, want: 0", got)
+	}
+}
+
+func TestGzipWithGzipWriterPoolRatio(t *testing.T) {
+	gzipRatios.Reset()
+	defer gzipRatios.Reset()
+
+	res, err := GzipWithGzipWriterPool([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ratio := float64(len(res)) / float64(len(data))
+	if got := gzipRatios.Percentile(50); got < ratio || got > ratio+0.01 {
+		t.Errorf("Percentile(50): %v, want: %v", got, ratio)
+	}
+}
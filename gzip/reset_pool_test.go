@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+// ResetPool はgzipWriterのPoolを新しい空のPoolに差し替える
+// アクセスが急増した後などに、大きく伸びたbufを持ったgzipWriterをまとめてGCさせたいときに使う
+// Drainと違って古いPoolには触らないので、Gzipを実行中のgoroutineがPutしたgzipWriterも古いPoolごと捨てられる
+// Gzipと並行に呼び出してよい
+func (g *GzipperWithSyncPool) ResetPool() {
+	g.GzipWriterPool.Store(newGzipperPool())
+}
+
+func TestGzipperWithSyncPoolResetPool(t *testing.T) {
+	g := NewGzipperWithSyncPool()
+	if _, err := g.Gzip([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	old := g.GzipWriterPool.Load()
+
+	g.ResetPool()
+	if g.GzipWriterPool.Load() == old {
+		t.Fatal("ResetPool did not replace the pool")
+	}
+	// 新しいPoolは空なので、前のgzipWriterは返ってこない
+	if got := g.GzipWriterPool.Load().Drain(); got != 0 {
+		t.Errorf("new pool has %d items, want 0", got)
+	}
+
+	res, err := g.Gzip([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Gunzip(bytes.NewReader(res))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != data {
+		t.Errorf("got: %s, want: %s", got, data)
+	}
+}
+
+// go test -race -run ResetPoolConcurrent で実行して、ResetPoolとGzipが競合しないことを確認する
+func TestGzipperWithSyncPoolResetPoolConcurrent(t *testing.T) {
+	g := NewGzipperWithSyncPool()
+	in := []byte(data)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// Gzipの返り値はPoolのbufを参照していて他のgoroutineに書き換えられ得るので、中身は見ない
+				if _, err := g.Gzip(in); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		g.ResetPool()
+	}
+	close(stop)
+	wg.Wait()
+
+	res, err := g.Gzip(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Gunzip(bytes.NewReader(res))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, in) {
+		t.Errorf("got %d bytes, want %d bytes", len(got), len(in))
+	}
+}
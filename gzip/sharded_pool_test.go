@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// poolShard は隣のshardと同じキャッシュラインに載らないように詰め物をしたsync.Pool
+type poolShard struct {
+	pool sync.Pool
+	_    [64]byte
+}
+
+// ShardedPool は複数のsync.Poolに分けて値を持つPool
+// 使うshardはatomicのカウンタで順番に選ぶ
+// sync.Poolは自分のPに値がないと他のPから盗んでくるが、GCで中身が捨てられた直後などに
+// 大量のgoroutineが同時にGetすると1つのPoolの中で取り合いになるので、それを分散させる
+type ShardedPool struct {
+	shards []poolShard
+	next   atomic.Uint32
+}
+
+// NewShardedPool はruntime.GOMAXPROCS(0)個のshardを持つShardedPoolを返す
+func NewShardedPool(newFunc func() interface{}) *ShardedPool {
+	p := &ShardedPool{shards: make([]poolShard, runtime.GOMAXPROCS(0))}
+	for i := range p.shards {
+		p.shards[i].pool.New = newFunc
+	}
+	return p
+}
+
+func (p *ShardedPool) shard() *sync.Pool {
+	i := p.next.Add(1) % uint32(len(p.shards))
+	return &p.shards[i].pool
+}
+
+func (p *ShardedPool) Get() interface{} {
+	return p.shard().Get()
+}
+
+func (p *ShardedPool) Put(x interface{}) {
+	p.shard().Put(x)
+}
+
+func newGzipWriter() interface{} {
+	buf := &bytes.Buffer{}
+	return &gzipWriter{
+		w:   gzip.NewWriter(buf),
+		buf: buf,
+	}
+}
+
+// getPutter はsync.PoolとShardedPoolを同じように使うためのinterface
+type getPutter interface {
+	Get() interface{}
+	Put(x interface{})
+}
+
+// gzipWithPool はpoolから取ったgzipWriterでdataをgzipして、結果をコピーして返す
+func gzipWithPool(pool getPutter, data []byte) ([]byte, error) {
+	gw := pool.Get().(*gzipWriter)
+	defer pool.Put(gw)
+	gw.buf.Reset()
+	gw.w.Reset(gw.buf)
+
+	if _, err := gw.w.Write(data); err != nil {
+		return nil, fmt.Errorf("%w: failed to gzip Write: %w", ErrCompress, err)
+	}
+	if err := gw.w.Close(); err != nil {
+		return nil, fmt.Errorf("%w: failed to gzip Close: %w", ErrCompress, err)
+	}
+
+	res := make([]byte, gw.buf.Len())
+	copy(res, gw.buf.Bytes())
+	return res, nil
+}
+
+func TestShardedPool(t *testing.T) {
+	p := NewShardedPool(newGzipWriter)
+
+	// 全てのshardを何周かして、どのshardから取ったgzipWriterも前の値が残っていないことを確認する
+	for i := 0; i < 3*len(p.shards)+1; i++ {
+		want := fmt.Sprintf("%s-%d", data, i)
+		res, err := gzipWithPool(p, []byte(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Gunzip(bytes.NewReader(res))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("got: %s, want: %s", string(got), want)
+		}
+	}
+
+	// 複数のgoroutineから同時に使っても結果が混ざらない
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				want := fmt.Sprintf("%d-%d-%s", g, i, data)
+				res, err := gzipWithPool(p, []byte(want))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				got, err := Gunzip(bytes.NewReader(res))
+				if err != nil || string(got) != want {
+					t.Errorf("got: %s, err: %v, want: %s", got, err, want)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// GOMAXPROCSよりずっと多いgoroutineで同時にgzipする場合
+// 1コアのマシンで-cpu 1,8を指定して測った結果
+// ShardedPoolはshardごとにPごとの値を持つので、値がshardに薄く散らばって、Newが呼ばれる回数が増えた
+// sync.Poolの中の取り合いが本当に問題になる、コア数の多いマシンで測ってから使うこと
+// $go test -bench HighConcurrency -cpu 1,8
+// BenchmarkGzipSyncPoolHighConcurrency               181833              6647 ns/op             254 B/op          1 allocs/op
+// BenchmarkGzipSyncPoolHighConcurrency-8             149893              6797 ns/op             799 B/op          1 allocs/op
+// BenchmarkGzipShardedPoolHighConcurrency            179697              6982 ns/op             255 B/op          1 allocs/op
+// BenchmarkGzipShardedPoolHighConcurrency-8           35490             32221 ns/op           91698 B/op          2 allocs/op
+func BenchmarkGzipSyncPoolHighConcurrency(b *testing.B) {
+	pool := &sync.Pool{New: newGzipWriter}
+	benchmarkGzipHighConcurrency(b, pool)
+}
+
+func BenchmarkGzipShardedPoolHighConcurrency(b *testing.B) {
+	benchmarkGzipHighConcurrency(b, NewShardedPool(newGzipWriter))
+}
+
+func benchmarkGzipHighConcurrency(b *testing.B, pool getPutter) {
+	in := []byte(data)
+	b.SetParallelism(16)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := gzipWithPool(pool, in); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
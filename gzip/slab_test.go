@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// Slab はPoolから借りたbufの中身をコピーして貯めておくための領域
+// GzipWithGzipWriterPoolなどの返り値はPoolのbufを参照しているので、
+// 次の呼び出しで上書きされる前にAppendでSlabにコピーしておく
+type Slab struct {
+	buf []byte
+}
+
+// NewSlab はcapacityバイト分の領域を先に確保したSlabを返す
+func NewSlab(capacity int) *Slab {
+	return &Slab{buf: make([]byte, 0, capacity)}
+}
+
+// Append はsrcをSlabにコピーして、コピーした部分のSliceを返す
+// 容量が足りないときは新しい領域を確保するが、前に返したSliceは古い領域を参照したままなので壊れない
+// 返すSliceはcapを長さに合わせているので、呼び出し側がappendしても隣の値を上書きしない
+func (s *Slab) Append(src []byte) []byte {
+	if cap(s.buf)-len(s.buf) < len(src) {
+		newCap := 2 * cap(s.buf)
+		if newCap < len(src) {
+			newCap = len(src)
+		}
+		// 古い領域の中身は前に返したSliceが使っているのでコピーしない
+		s.buf = make([]byte, 0, newCap)
+	}
+	start := len(s.buf)
+	s.buf = append(s.buf, src...)
+	return s.buf[start:len(s.buf):len(s.buf)]
+}
+
+func TestSlab(t *testing.T) {
+	// 小さい領域から始めて、途中で領域を確保し直す場合も確認する
+	slab := NewSlab(16)
+
+	var inputs []string
+	var results [][]byte
+	for i := 0; i < 10; i++ {
+		in := fmt.Sprintf("%s-%d", data, i)
+		compressed, err := GzipWithGzipWriterPool([]byte(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, in)
+		results = append(results, slab.Append(compressed))
+	}
+
+	// Poolのbufを使い回して上書きさせる
+	for i := 0; i < 10; i++ {
+		if _, err := GzipWithGzipWriterPool(bytes.Repeat([]byte("x"), 1000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, r := range results {
+		got, err := Gunzip(bytes.NewReader(r))
+		if err != nil {
+			t.Fatalf("result %d: %v", i, err)
+		}
+		if string(got) != inputs[i] {
+			t.Errorf("got: %s, want: %s", string(got), inputs[i])
+		}
+	}
+
+	// 返したSliceにappendしても隣の値は変わらない
+	_ = append(results[0], 'x')
+	if got, err := Gunzip(bytes.NewReader(results[1])); err != nil || string(got) != inputs[1] {
+		t.Errorf("append to result 0 broke result 1: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+var errStreamGzipperClosed = errors.New("StreamGzipper is already closed")
+
+// StreamGzipper は1つのストリーム(コネクションなど)にgzipしたデータを少しずつ書き込む
+// ストリームを使っている間はPoolから取ったgzipWriterNoBufを持ち続けて、Closeした時にPoolに戻す
+// 並行に使うことはできない
+type StreamGzipper struct {
+	gw *gzipWriterNoBuf
+}
+
+func NewStreamGzipper(w io.Writer) *StreamGzipper {
+	return &StreamGzipper{gw: getGzipWriterNoBuf(w)}
+}
+
+func (s *StreamGzipper) Write(p []byte) (int, error) {
+	if s.gw == nil {
+		return 0, errStreamGzipperClosed
+	}
+	n, err := s.gw.w.Write(p)
+	if err != nil {
+		return n, fmt.Errorf("failed to gzip Write: %v", err)
+	}
+	return n, nil
+}
+
+// Flush はそれまでに書き込んだデータを圧縮して書き出す
+// gzip.Writer.Flushで同期用のマーカーを書き込むので、
+// 受け取った側はCloseを待たずにそこまでのデータを展開できる
+func (s *StreamGzipper) Flush() error {
+	if s.gw == nil {
+		return errStreamGzipperClosed
+	}
+	if err := s.gw.w.Flush(); err != nil {
+		return fmt.Errorf("failed to gzip Flush: %v", err)
+	}
+	return nil
+}
+
+// Close はgzipのフッタを書き込んで、gzipWriterNoBufをPoolに戻す
+func (s *StreamGzipper) Close() error {
+	if s.gw == nil {
+		return errStreamGzipperClosed
+	}
+	gw := s.gw
+	s.gw = nil
+
+	err := gw.w.Close()
+	putGzipWriterNoBuf(gw)
+	if err != nil {
+		return fmt.Errorf("failed to gzip Close: %v", err)
+	}
+	return nil
+}
+
+func TestStreamGzipper(t *testing.T) {
+	first := "first frame\n"
+	second := "second frame\n"
+
+	var conn bytes.Buffer
+	s := NewStreamGzipper(&conn)
+
+	if _, err := s.Write([]byte(first)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Closeする前でも、Flushした所までは展開できる
+	gr, err := gzip.NewReader(bytes.NewReader(conn.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(first))
+	if _, err := io.ReadFull(gr, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != first {
+		t.Errorf("got: %s, want: %s", string(got), first)
+	}
+
+	if _, err := s.Write([]byte(second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := Gunzip(&conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(all) != first+second {
+		t.Errorf("got: %s, want: %s", string(all), first+second)
+	}
+
+	if _, err := s.Write([]byte("after close")); !errors.Is(err, errStreamGzipperClosed) {
+		t.Errorf("got: %v, want: %v", err, errStreamGzipperClosed)
+	}
+}
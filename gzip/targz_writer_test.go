@@ -0,0 +1,140 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+var errTarGzWriterClosed = errors.New("TarGzWriter is already closed")
+
+// TarGzWriter は複数のファイルをtar.gzにまとめる
+// tar.WriterをPoolから取ったgzip.Writerに直接書き込むので、tarの中間データを別のbufに持たない
+// Closeするまでの間gzipWriterを持ち続けて、Closeした時にPoolに戻す。並行に使うことはできない
+type TarGzWriter struct {
+	gw *gzipWriter
+	tw *tar.Writer
+}
+
+// NewTarGzWriter はsizeHintの分だけPoolのbufを伸ばしておく
+// 圧縮後のサイズが分かっていれば、Close前のbufの再確保を減らせる
+func NewTarGzWriter(sizeHint int) *TarGzWriter {
+	gw := gzipWriterPool.Get().(*gzipWriter)
+	gw.markGet()
+	gw.buf.Reset()
+	if sizeHint > 0 {
+		gw.buf.Grow(sizeHint)
+	}
+	gw.w.Reset(gw.buf)
+	return &TarGzWriter{gw: gw, tw: tar.NewWriter(gw.w)}
+}
+
+// AddFile はnameというファイル名でcontentを追加する
+func (t *TarGzWriter) AddFile(name string, content []byte) error {
+	if t.gw == nil {
+		return errTarGzWriterClosed
+	}
+	hdr := &tar.Header{
+		Name: name,
+		Mode: 0o644,
+		// Sizeとcontentの長さが違うとtar.Writerがエラーにする
+		Size: int64(len(content)),
+	}
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("%w: failed to tar WriteHeader: %w", ErrCompress, err)
+	}
+	if _, err := t.tw.Write(content); err != nil {
+		return fmt.Errorf("%w: failed to tar Write: %w", ErrCompress, err)
+	}
+	return nil
+}
+
+// Close はtarの終端とgzipのフッタを書き込んで、出来上がったtar.gzを返す
+// 返り値はPoolのbufからコピーしたもの。gzipWriterはPoolに戻す
+func (t *TarGzWriter) Close() ([]byte, error) {
+	if t.gw == nil {
+		return nil, errTarGzWriterClosed
+	}
+	gw, tw := t.gw, t.tw
+	t.gw, t.tw = nil, nil
+	defer putUnlessPanic(&gzipWriterPool, gw)
+
+	// tar.Writer.Closeは最後のファイルの512バイト境界までのパディングと、終端の2ブロックを書き込む
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("%w: failed to tar Close: %w", ErrCompress, err)
+	}
+	if err := gw.w.Close(); err != nil {
+		return nil, fmt.Errorf("%w: failed to gzip Close: %w", ErrCompress, err)
+	}
+
+	res := make([]byte, gw.buf.Len())
+	copy(res, gw.buf.Bytes())
+	return res, nil
+}
+
+func TestTarGzWriter(t *testing.T) {
+	files := []struct {
+		name    string
+		content []byte
+	}{
+		{"a.txt", []byte(data)},
+		// 512バイト境界に揃わない長さでパディングを確認する
+		{"dir/b.bin", bytes.Repeat([]byte{0, 1, 2}, 1000)},
+	}
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得るので、複数回実行する
+	for i := 0; i < 2; i++ {
+		w := NewTarGzWriter(1024)
+		for _, f := range files {
+			if err := w.AddFile(f.name, f.content); err != nil {
+				t.Fatal(err)
+			}
+		}
+		archive, err := w.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		zr, err := gzip.NewReader(bytes.NewReader(archive))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := tar.NewReader(zr)
+		for _, f := range files {
+			hdr, err := tr.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hdr.Name != f.name || hdr.Size != int64(len(f.content)) {
+				t.Errorf("got header %s (%d bytes), want %s (%d bytes)", hdr.Name, hdr.Size, f.name, len(f.content))
+			}
+			got, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, f.content) {
+				t.Errorf("%s: got %d bytes, want %d bytes", f.name, len(got), len(f.content))
+			}
+		}
+		if _, err := tr.Next(); err != io.EOF {
+			t.Errorf("got %v after the last file, want io.EOF", err)
+		}
+	}
+}
+
+func TestTarGzWriterClosed(t *testing.T) {
+	w := NewTarGzWriter(0)
+	if _, err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddFile("a.txt", nil); !errors.Is(err, errTarGzWriterClosed) {
+		t.Errorf("AddFile after Close: got %v, want %v", err, errTarGzWriterClosed)
+	}
+	if _, err := w.Close(); !errors.Is(err, errTarGzWriterClosed) {
+		t.Errorf("second Close: got %v, want %v", err, errTarGzWriterClosed)
+	}
+}
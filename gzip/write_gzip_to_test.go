@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// 書き込んだバイト数を数えるWriter
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// WriteGzipTo はdataをgzipしながらwに直接書き込み、書き込んだ圧縮後のバイト数を返す
+// ソケットなどに直接書き込むときに、途中の[]byteを作らずに済む
+func WriteGzipTo(w io.Writer, data []byte) (int64, error) {
+	cw := &countingWriter{w: w}
+	gw := getGzipWriterNoBuf(cw)
+	defer putGzipWriterNoBuf(gw)
+
+	if _, err := gw.w.Write(data); err != nil {
+		return cw.n, fmt.Errorf("failed to gzip Write: %v", err)
+	}
+	if err := gw.w.Close(); err != nil {
+		return cw.n, fmt.Errorf("failed to gzip Close: %v", err)
+	}
+	return cw.n, nil
+}
+
+func TestWriteGzipTo(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		var dst bytes.Buffer
+		cw := &countingWriter{w: &dst}
+		n, err := WriteGzipTo(cw, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != cw.n {
+			t.Errorf("returned: %d, written: %d", n, cw.n)
+		}
+		if n != int64(dst.Len()) {
+			t.Errorf("returned: %d, dst.Len: %d", n, dst.Len())
+		}
+
+		got, err := Gunzip(bytes.NewReader(dst.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Errorf("got: %s, want: %s", string(got), data)
+		}
+
+		// Poolに戻ったWriterを使っても、呼び出し元のdstには書き込まれない
+		gw := gzipWriterNoBufPool.Get().(*gzipWriterNoBuf)
+		gw.w.Write([]byte("other data"))
+		gw.w.Flush()
+		gzipWriterNoBufPool.Put(gw)
+		if int64(dst.Len()) != n {
+			t.Errorf("pooled writer still references dst: len %d, want %d", dst.Len(), n)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// NewClient はtimeoutを設定したhttp.Clientを返す
+// http.DefaultClientや素のhttp.ClientはTimeoutが0(無制限)なので、サーバが応答しないとずっと待ってしまう
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout}
+}
+
+// Request はctxを付けてurlにGETし、レスポンスのBodyを返す
+// Bodyの読み込みにはPoolのbufを使い、返す前にコピーする
+// ctxのDeadlineとclient.Timeoutのどちらか早い方で打ち切られる
+func Request(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to NewRequest: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	buf := bufPool.Get().(*bytes.Buffer)
+	defer bufPool.Put(buf)
+	buf.Reset()
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %d, body: %s", resp.StatusCode, buf.Bytes())
+	}
+
+	res := make([]byte, buf.Len())
+	copy(res, buf.Bytes())
+	return res, nil
+}
+
+// newSleepServer はsleepだけ待ってからbodyを返すサーバを作る
+// クライアントが先に諦めた場合はすぐに返るので、ts.Closeで待たされない
+func newSleepServer(sleep time.Duration, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(sleep):
+		case <-r.Context().Done():
+			return
+		}
+		io.WriteString(w, body)
+	}))
+}
+
+func TestRequest(t *testing.T) {
+	ts := newSleepServer(0, "hello")
+	defer ts.Close()
+
+	client := NewClient(time.Second)
+	for i := 0; i < 2; i++ {
+		got, err := Request(context.Background(), client, ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "hello" {
+			t.Errorf("got: %s, want: %s", got, "hello")
+		}
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	ts := newSleepServer(time.Second, "too late")
+	defer ts.Close()
+
+	t.Run("ClientTimeout", func(t *testing.T) {
+		client := NewClient(50 * time.Millisecond)
+		_, err := Request(context.Background(), client, ts.URL)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got: %v, want: %v", err, context.DeadlineExceeded)
+		}
+	})
+	t.Run("ContextDeadline", func(t *testing.T) {
+		client := NewClient(time.Minute)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := Request(ctx, client, ts.URL)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got: %v, want: %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+var Result []byte
+
+// BenchmarkRequest はベンチマークごとにhttptestのサーバを立てるので、外部のサーバやポートに依存しない
+func BenchmarkRequest(b *testing.B) {
+	ts := newSleepServer(0, "hello")
+	defer ts.Close()
+	client := NewClient(time.Second)
+
+	// 最初のリクエストはTCPの接続を作る分だけ遅いので、計測の前に1回送ってKeep-Aliveの接続とPoolのbufを用意しておく
+	if _, err := Request(context.Background(), client, ts.URL); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		var err error
+		r, err = Request(context.Background(), client, ts.URL)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	Result = r
+}
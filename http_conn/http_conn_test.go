@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var bufPool = &sync.Pool{
+	New: func() interface{} {
+		return &bytes.Buffer{}
+	},
+}
+
+// pooledBody はPoolから取ったbytes.Bufferを中身として持つRequest Body
+// http.ClientはRequestを送り終わるとBodyをCloseするので、その時にbufをPoolに戻す
+// Transportは別のgoroutineからCloseすることがあるのでMutexで守る
+type pooledBody struct {
+	mu  sync.Mutex
+	buf *bytes.Buffer
+}
+
+func (b *pooledBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.buf == nil {
+		return 0, io.EOF
+	}
+	return b.buf.Read(p)
+}
+
+func (b *pooledBody) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.buf != nil {
+		bufPool.Put(b.buf)
+		b.buf = nil
+	}
+	return nil
+}
+
+// BuildMultipart はfieldsとfilesからmultipart/form-dataのBodyを作る
+// filesのキーはフィールド名とファイル名の両方に使う
+// 返したbodyはPoolのbufを持っているので、http.NewRequestに渡すかCloseしてbufをPoolに戻すこと
+func BuildMultipart(fields map[string]string, files map[string][]byte) (body io.Reader, contentType string, err error) {
+	buf := bufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	// multipart.Writerはboundaryを毎回ランダムに作りたいのでPoolには入れない
+	mw := multipart.NewWriter(buf)
+	if err := writeMultipart(mw, fields, files); err != nil {
+		bufPool.Put(buf)
+		return nil, "", err
+	}
+	return &pooledBody{buf: buf}, mw.FormDataContentType(), nil
+}
+
+func writeMultipart(mw *multipart.Writer, fields map[string]string, files map[string][]byte) error {
+	// mapの順番はランダムなので、毎回同じBodyになるようにキーでソートしておく
+	for _, k := range sortedKeys(fields) {
+		if err := mw.WriteField(k, fields[k]); err != nil {
+			return fmt.Errorf("failed to WriteField: %v", err)
+		}
+	}
+	fileNames := make([]string, 0, len(files))
+	for k := range files {
+		fileNames = append(fileNames, k)
+	}
+	sort.Strings(fileNames)
+	for _, name := range fileNames {
+		fw, err := mw.CreateFormFile(name, name)
+		if err != nil {
+			return fmt.Errorf("failed to CreateFormFile: %v", err)
+		}
+		if _, err := fw.Write(files[name]); err != nil {
+			return fmt.Errorf("failed to Write file: %v", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return fmt.Errorf("failed to Close multipart Writer: %v", err)
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestBuildMultipart(t *testing.T) {
+	// 受け取ったフィールドとファイルをそのまま返すサーバ
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, k := range []string{"name", "q"} {
+			fmt.Fprintf(w, "%s=%s\n", k, r.FormValue(k))
+		}
+		for _, k := range []string{"a.txt", "b.txt"} {
+			f, _, err := r.FormFile(k)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			content, _ := io.ReadAll(f)
+			f.Close()
+			fmt.Fprintf(w, "%s:%s\n", k, content)
+		}
+	}))
+	defer ts.Close()
+
+	fields := map[string]string{"name": "Jack", "q": "flowers"}
+	files := map[string][]byte{
+		"a.txt": []byte("knife"),
+		"b.txt": []byte("shield"),
+	}
+	want := "name=Jack\nq=flowers\na.txt:knife\nb.txt:shield\n"
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		body, contentType, err := BuildMultipart(fields, files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Post(ts.URL, contentType, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status: %d, body: %s", resp.StatusCode, got)
+		}
+		if string(got) != want {
+			t.Errorf("got: %s, want: %s", got, want)
+		}
+
+		// 送信後はbufがPoolに戻っている
+		pb := body.(*pooledBody)
+		pb.mu.Lock()
+		released := pb.buf == nil
+		pb.mu.Unlock()
+		if !released {
+			t.Error("buffer was not released after the request")
+		}
+	}
+}
+
+func TestBuildMultipartContent(t *testing.T) {
+	body, contentType, err := BuildMultipart(map[string]string{"k": "v"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.(io.Closer).Close()
+	if !strings.HasPrefix(contentType, "multipart/form-data; boundary=") {
+		t.Errorf("contentType: %s", contentType)
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "name=\"k\"\r\n\r\nv\r\n") {
+		t.Errorf("body: %q", b)
+	}
+}
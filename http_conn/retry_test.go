@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// replayBuffer はリトライで何度も送るRequest BodyをPoolのbufに保持する
+// TransportはBodyのCloseを別のgoroutineで、RoundTripが返った後に呼ぶことがあるので、
+// 作ったBodyが全部Closeされてからbufを戻すように参照数を数える
+type replayBuffer struct {
+	buf  *bytes.Buffer
+	refs int32
+}
+
+func newReplayBuffer(body io.Reader) (*replayBuffer, error) {
+	buf := bufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if body != nil {
+		if _, err := buf.ReadFrom(body); err != nil {
+			bufPool.Put(buf)
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
+	// DoWithRetry自身の分の参照
+	return &replayBuffer{buf: buf, refs: 1}, nil
+}
+
+func (rb *replayBuffer) release() {
+	if atomic.AddInt32(&rb.refs, -1) == 0 {
+		bufPool.Put(rb.buf)
+	}
+}
+
+// newBody はbufを先頭から読むBodyを作る
+func (rb *replayBuffer) newBody() io.ReadCloser {
+	atomic.AddInt32(&rb.refs, 1)
+	return &replayBody{Reader: bytes.NewReader(rb.buf.Bytes()), rb: rb}
+}
+
+type replayBody struct {
+	*bytes.Reader
+	rb   *replayBuffer
+	once sync.Once
+}
+
+func (b *replayBody) Close() error {
+	b.once.Do(b.rb.release)
+	return nil
+}
+
+// DoWithRetry はネットワークエラーか5xxのときに、backoffを倍にしながら最大attempts回までreqを送る
+// req.Bodyは一度しか読めないので、最初にPoolのbufへ読み込んでおき、毎回そこから送り直す
+// 最後の試行も5xxだった場合は、そのレスポンスをそのまま返す
+// req.Context()がキャンセルされたら待たずにそのエラーを返す
+func DoWithRetry(client *http.Client, req *http.Request, attempts int, backoff time.Duration) (*http.Response, error) {
+	if attempts < 1 {
+		return nil, fmt.Errorf("attempts must be positive: %d", attempts)
+	}
+	rb, err := newReplayBuffer(req.Body)
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rb.release()
+
+	ctx := req.Context()
+	for i := 0; ; i++ {
+		r := req.Clone(ctx)
+		r.Body = rb.newBody()
+		r.GetBody = func() (io.ReadCloser, error) { return rb.newBody(), nil }
+		r.ContentLength = int64(rb.buf.Len())
+
+		resp, err := client.Do(r)
+		if err == nil && resp.StatusCode < 500 {
+			return resp, nil
+		}
+		if i == attempts-1 {
+			if err != nil {
+				return nil, fmt.Errorf("failed after %d attempts: %w", attempts, err)
+			}
+			return resp, nil
+		}
+		if err == nil {
+			// コネクションを使い回せるように読み切ってから閉じる
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(backoff << i):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("retry canceled: %w", ctx.Err())
+		}
+	}
+}
+
+// newFlakyServer は最初のfailures回は500を返し、その後は受け取ったBodyをそのまま返すサーバを作る
+func newFlakyServer(failures int32, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if atomic.AddInt32(calls, 1) <= failures {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Write(body)
+	}))
+}
+
+func TestDoWithRetry(t *testing.T) {
+	var calls int32
+	ts := newFlakyServer(2, &calls)
+	defer ts.Close()
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		atomic.StoreInt32(&calls, 0)
+		want := fmt.Sprintf("payload-%d", i)
+		req, err := http.NewRequest(http.MethodPost, ts.URL, bytes.NewBufferString(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := DoWithRetry(NewClient(time.Second), req, 5, time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status: %d, body: %s", resp.StatusCode, got)
+		}
+		// 3回目で成功し、毎回同じBodyが送られている
+		if c := atomic.LoadInt32(&calls); c != 3 {
+			t.Errorf("got %d calls, want: 3", c)
+		}
+		if string(got) != want {
+			t.Errorf("got: %s, want: %s", got, want)
+		}
+	}
+}
+
+func TestDoWithRetryGiveUp(t *testing.T) {
+	var calls int32
+	ts := newFlakyServer(10, &calls)
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := DoWithRetry(NewClient(time.Second), req, 3, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("status: %d, want: %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+	if c := atomic.LoadInt32(&calls); c != 3 {
+		t.Errorf("got %d calls, want: 3", c)
+	}
+}
+
+func TestDoWithRetryCanceled(t *testing.T) {
+	var calls int32
+	ts := newFlakyServer(10, &calls)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1回目が失敗してbackoffで待っている間にキャンセルする
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = DoWithRetry(NewClient(time.Second), req, 3, time.Minute)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got: %v, want: %v", err, context.Canceled)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("DoWithRetry did not return promptly after cancel: %v", d)
+	}
+}
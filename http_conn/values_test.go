@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// valuesEncoder はEncodeValuesWithPoolの作業用のbufとキーのSlice
+type valuesEncoder struct {
+	buf  bytes.Buffer
+	keys []string
+}
+
+var valuesEncoderPool = &sync.Pool{
+	New: func() interface{} {
+		return &valuesEncoder{}
+	},
+}
+
+// EncodeValuesWithPool はurl.Values.Encodeと同じ文字列を返す
+// url.Values.Encodeは毎回キーのSliceと結果を組み立てるbufを確保するので、それをPoolで使いまわす
+// url.QueryEscapeはエスケープする文字がなければ確保しないので、返り値のstringを作るアロケーションだけになることが多い
+func EncodeValuesWithPool(v url.Values) string {
+	if len(v) == 0 {
+		return ""
+	}
+	e := valuesEncoderPool.Get().(*valuesEncoder)
+	defer func() {
+		// Poolに戻した後にキーの文字列を参照し続けないようにする
+		clear(e.keys)
+		e.keys = e.keys[:0]
+		valuesEncoderPool.Put(e)
+	}()
+	e.buf.Reset()
+	e.keys = e.keys[:0]
+
+	for k := range v {
+		e.keys = append(e.keys, k)
+	}
+	slices.Sort(e.keys)
+	for _, k := range e.keys {
+		keyEscaped := url.QueryEscape(k)
+		for _, val := range v[k] {
+			if e.buf.Len() > 0 {
+				e.buf.WriteByte('&')
+			}
+			e.buf.WriteString(keyEscaped)
+			e.buf.WriteByte('=')
+			e.buf.WriteString(url.QueryEscape(val))
+		}
+	}
+	return e.buf.String()
+}
+
+var valuesInputs = map[string]url.Values{
+	"empty":  {},
+	"nil":    nil,
+	"simple": {"q": {"flowers"}, "name": {"Jack"}},
+	"multi":  {"item": {"knife", "shield", "herbs"}, "id": {"1"}},
+	"escape": {"q": {"a b&c=d/e?f"}, "日本語": {"値"}, "empty": {""}},
+	// 値が空のSliceのキーはurl.Values.Encodeでも出力されない
+	"no_values": {"a": {}, "b": {"1"}},
+}
+
+func TestEncodeValuesWithPool(t *testing.T) {
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		for name, v := range valuesInputs {
+			t.Run(name, func(t *testing.T) {
+				got := EncodeValuesWithPool(v)
+				if want := v.Encode(); got != want {
+					t.Errorf("got: %s, want: %s", got, want)
+				}
+			})
+		}
+	}
+}
+
+var ValuesResult string
+
+// go test -run XX -bench Values .
+// BenchmarkValuesEncode         	 3265833	       310.9 ns/op	     120 B/op	       4 allocs/op
+// BenchmarkEncodeValuesWithPool 	 4566907	       274.7 ns/op	      48 B/op	       1 allocs/op
+
+func BenchmarkValuesEncode(b *testing.B) {
+	v := valuesInputs["multi"]
+	b.ReportAllocs()
+	var r string
+	for n := 0; n < b.N; n++ {
+		r = v.Encode()
+	}
+	ValuesResult = r
+}
+
+func BenchmarkEncodeValuesWithPool(b *testing.B) {
+	v := valuesInputs["multi"]
+	b.ReportAllocs()
+	var r string
+	for n := 0; n < b.N; n++ {
+		r = EncodeValuesWithPool(v)
+	}
+	ValuesResult = r
+}
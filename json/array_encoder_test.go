@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var errArrayEncoderNotOpen = errors.New("ArrayEncoder is not open")
+
+// ArrayEncoder はJsonDataを1つずつwに書き込んで、全体で1つのJSONの配列にする
+// 要素ごとのエンコードにはOpenでPoolから取った1つのbufを使い回し、Closeで戻す
+// chunkedやserver-sent eventsのように、全要素が揃う前に書き出したいときに使う
+type ArrayEncoder struct {
+	w   io.Writer
+	buf *bytes.Buffer
+	n   int   // 書き込んだ要素の数
+	err error // 一度書き込みに失敗したら、それ以降はこのエラーを返す
+}
+
+// Open はwに配列の始まりを書き込む
+func (a *ArrayEncoder) Open(w io.Writer) error {
+	a.w = w
+	a.buf = encRespPool.Get().(*bytes.Buffer)
+	a.n = 0
+	a.err = nil
+	if _, err := io.WriteString(w, "["); err != nil {
+		a.err = err
+	}
+	return a.err
+}
+
+// Append はinを配列の要素として書き込む
+func (a *ArrayEncoder) Append(in JsonData) error {
+	if a.buf == nil {
+		return errArrayEncoderNotOpen
+	}
+	if a.err != nil {
+		return a.err
+	}
+
+	a.buf.Reset()
+	if a.n > 0 {
+		a.buf.WriteByte(',')
+	}
+	e := getJSONEncoder(a.buf)
+	err := e.enc.Encode(in)
+	putJSONEncoder(e, err)
+	if err != nil {
+		// エンコードに失敗した要素はwに書き込んでいないので、後の要素は続けて書き込める
+		return err
+	}
+	a.buf.Truncate(a.buf.Len() - 1) // Encodeが最後に付ける改行は除く
+
+	if _, err := a.w.Write(a.buf.Bytes()); err != nil {
+		a.err = err
+		return err
+	}
+	a.n++
+	return nil
+}
+
+// Close は配列の終わりを書き込んで、bufをPoolに戻す
+// 要素が1つもなければ [] になる
+func (a *ArrayEncoder) Close() error {
+	if a.buf == nil {
+		return errArrayEncoderNotOpen
+	}
+	encRespPool.Put(a.buf)
+	a.buf = nil
+	w := a.w
+	a.w = nil // 呼び出し元のWriterを参照し続けないようにする
+
+	if a.err != nil {
+		return a.err
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+func TestArrayEncoder(t *testing.T) {
+	items := []JsonData{
+		{ID: 1, Name: "Jack", Items: []string{"knife", "shield", "herbs"}},
+		{ID: 2, Name: "Jill", Items: []string{}},
+		{ID: 3, Name: "Bob"},
+	}
+
+	for _, n := range []int{3, 0, 1} {
+		// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+		// そのため、２回実行しても同じ結果であることを確認している
+		for i := 0; i < 2; i++ {
+			var out bytes.Buffer
+			var a ArrayEncoder
+			if err := a.Open(&out); err != nil {
+				t.Fatal(err)
+			}
+			for _, item := range items[:n] {
+				if err := a.Append(item); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := a.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []JsonData
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatalf("failed to Unmarshal %s: %v", out.String(), err)
+			}
+			if diff := cmp.Diff(got, items[:n]); diff != "" {
+				t.Errorf("got: %v,want: %v, diff: %s", got, items[:n], diff)
+			}
+			if n == 0 && out.String() != "[]" {
+				t.Errorf("got: %s, want: []", out.String())
+			}
+		}
+	}
+}
+
+func TestArrayEncoderErrors(t *testing.T) {
+	var a ArrayEncoder
+	if err := a.Append(JData); !errors.Is(err, errArrayEncoderNotOpen) {
+		t.Errorf("got: %v, want: %v", err, errArrayEncoderNotOpen)
+	}
+	if err := a.Close(); !errors.Is(err, errArrayEncoderNotOpen) {
+		t.Errorf("got: %v, want: %v", err, errArrayEncoderNotOpen)
+	}
+
+	// 書き込みに失敗したら、それ以降は同じエラーを返す
+	w := &failingWriter{after: 1}
+	if err := a.Open(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Append(JData); !errors.Is(err, errWrite) {
+		t.Errorf("got: %v, want: %v", err, errWrite)
+	}
+	if err := a.Append(JData); !errors.Is(err, errWrite) {
+		t.Errorf("got: %v, want: %v", err, errWrite)
+	}
+	if err := a.Close(); !errors.Is(err, errWrite) {
+		t.Errorf("got: %v, want: %v", err, errWrite)
+	}
+	if strings.Count(w.buf.String(), "[") != 1 {
+		t.Errorf("written: %s", w.buf.String())
+	}
+}
+
+var errWrite = errors.New("write error")
+
+// after回だけ書き込みに成功して、その後はerrWriteを返すWriter
+type failingWriter struct {
+	buf   bytes.Buffer
+	after int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if f.after <= 0 {
+		return 0, errWrite
+	}
+	f.after--
+	return f.buf.Write(p)
+}
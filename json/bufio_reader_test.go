@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Readが呼ばれた回数を数えるReader
+// maxが0より大きいときは、1回のReadでmaxバイトまでしか返さない
+type readCountingReader struct {
+	r     io.Reader
+	max   int
+	reads int
+}
+
+func (c *readCountingReader) Read(p []byte) (int, error) {
+	c.reads++
+	if c.max > 0 && len(p) > c.max {
+		p = p[:c.max]
+	}
+	return c.r.Read(p)
+}
+
+func TestDecodeJSONStreamWithPoolReads(t *testing.T) {
+	want := JsonData{ID: 1, Name: "Jack"}
+	for i := 0; i < 300; i++ {
+		want.Items = append(want.Items, fmt.Sprintf("item%d", i))
+	}
+	encoded, err := EncodeJSON(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := func(max int, decode func(io.Reader) (JsonData, error)) int {
+		r := &readCountingReader{r: strings.NewReader(encoded), max: max}
+		got, err := decode(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("got: %v,want: %v, diff: %s", got, want, diff)
+		}
+		return r.reads
+	}
+
+	// json.Decoderは512バイトずつ読むが、bufio.Readerを通すと4096バイトずつまとめて読める
+	reads := count(0, DecodeJSONStream)
+	readsWithPool := count(0, DecodeJSONStreamWithPool)
+	fmt.Printf("reads: DecodeJSONStream %d, DecodeJSONStreamWithPool %d\n", reads, readsWithPool)
+	if readsWithPool >= reads {
+		t.Errorf("DecodeJSONStreamWithPool reads: %d, want less than DecodeJSONStream: %d", readsWithPool, reads)
+	}
+
+	// 1回のReadで1バイトしか返さないReaderの場合は、bufio.Readerを通しても読む回数は減らない
+	// (bufio.Readerも1回のReadで1バイトしか受け取れないため)
+	reads = count(1, DecodeJSONStream)
+	readsWithPool = count(1, DecodeJSONStreamWithPool)
+	fmt.Printf("reads (1 byte per Read): DecodeJSONStream %d, DecodeJSONStreamWithPool %d\n", reads, readsWithPool)
+}
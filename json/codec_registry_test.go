@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// codecPool は型ごとのEncode用のbufのPool
+type codecPool struct {
+	pool sync.Pool
+	news int64 // Newが呼ばれた回数
+}
+
+// CodecRegistry は型ごとにbufのPoolを用意してEncode/Decodeする
+// 型ごとにPoolを手で宣言しなくても、最初にEncodeした時にその型のPoolを作ってsync.Mapに入れておく
+// 型によってJSONの大きさが違うので、Poolを分けておくと大きいbufと小さいbufが混ざらない
+type CodecRegistry struct {
+	pools sync.Map // reflect.Type -> *codecPool
+}
+
+func (r *CodecRegistry) poolFor(t reflect.Type) *codecPool {
+	if p, ok := r.pools.Load(t); ok {
+		return p.(*codecPool)
+	}
+	p := &codecPool{}
+	p.pool.New = func() interface{} {
+		atomic.AddInt64(&p.news, 1)
+		return &bytes.Buffer{}
+	}
+	actual, _ := r.pools.LoadOrStore(t, p)
+	return actual.(*codecPool)
+}
+
+// Encode はvをJSONにする。返り値はPoolのbufからコピーしたもの
+func (r *CodecRegistry) Encode(v interface{}) ([]byte, error) {
+	p := r.poolFor(reflect.TypeOf(v))
+	buf := p.pool.Get().(*bytes.Buffer)
+	defer p.pool.Put(buf)
+	buf.Reset()
+
+	e := getJSONEncoder(buf)
+	err := e.enc.Encode(v)
+	putJSONEncoder(e, err)
+	if err != nil {
+		return nil, err
+	}
+
+	// Encodeが最後に付ける改行は除く
+	res := make([]byte, buf.Len()-1)
+	copy(res, buf.Bytes())
+	return res, nil
+}
+
+// Decode はdataをvにデコードする
+// json.Unmarshalは作業用のbufを必要としないので、Poolは使わない
+func (r *CodecRegistry) Decode(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type Profile struct {
+	UserID  int64    `json:"user_id"`
+	Tags    []string `json:"tags"`
+	Premium bool     `json:"premium"`
+}
+
+func TestCodecRegistry(t *testing.T) {
+	r := &CodecRegistry{}
+
+	data := JsonData{
+		ID:    1,
+		Name:  "Jack",
+		Items: []string{"knife", "shield", "herbs"},
+	}
+	profile := Profile{
+		UserID:  100001,
+		Tags:    []string{"a", "b"},
+		Premium: true,
+	}
+
+	const runs = 10
+	for i := 0; i < runs; i++ {
+		enc, err := r.Encode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `{"id":1,"name":"Jack","items":["knife","shield","herbs"]}`; string(enc) != want {
+			t.Errorf("got: %s, want: %s", enc, want)
+		}
+		var gotData JsonData
+		if err := r.Decode(enc, &gotData); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(gotData, data); diff != "" {
+			t.Errorf("got: %v,want: %v, diff: %s", gotData, data, diff)
+		}
+
+		enc, err = r.Encode(profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `{"user_id":100001,"tags":["a","b"],"premium":true}`; string(enc) != want {
+			t.Errorf("got: %s, want: %s", enc, want)
+		}
+		var gotProfile Profile
+		if err := r.Decode(enc, &gotProfile); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(gotProfile, profile); diff != "" {
+			t.Errorf("got: %v,want: %v, diff: %s", gotProfile, profile, diff)
+		}
+	}
+
+	// 型ごとに別のPoolが作られていて、それぞれbufが再利用されている
+	dataPool := r.poolFor(reflect.TypeOf(data))
+	profilePool := r.poolFor(reflect.TypeOf(profile))
+	if dataPool == profilePool {
+		t.Fatal("JsonData and Profile share the same pool")
+	}
+	for name, p := range map[string]*codecPool{"JsonData": dataPool, "Profile": profilePool} {
+		news := atomic.LoadInt64(&p.news)
+		if news < 1 || news >= runs {
+			t.Errorf("%s pool New called %d times in %d runs", name, news, runs)
+		}
+	}
+
+	if _, err := r.Encode(make(chan int)); err == nil {
+		t.Error("want error for unsupported type")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// CompactJSONWithPool はsrcから意味のない空白を除いたJSONを返す
+// 外部から受け取ったJSONを比較や保存の前に正規化するときに使う
+// json.CompactはPoolのbufに書き込み、返り値はそこからコピーしたものなので、呼び出し側で自由に使ってよい
+func CompactJSONWithPool(src []byte) ([]byte, error) {
+	buf := encRespPool.Get().(*bytes.Buffer)
+	defer putUnlessPanic(encRespPool, buf)
+
+	buf.Reset()
+	if err := json.Compact(buf, src); err != nil {
+		return nil, err
+	}
+	res := make([]byte, buf.Len())
+	copy(res, buf.Bytes())
+	return res, nil
+}
+
+// IndentJSONWithPool はsrcをprefixとindentで字下げしたJSONを返す
+// CompactJSONWithPoolと同じく、json.IndentはPoolのbufに書き込み、返り値はそこからコピーしたもの
+func IndentJSONWithPool(src []byte, prefix, indent string) ([]byte, error) {
+	buf := encRespPool.Get().(*bytes.Buffer)
+	defer putUnlessPanic(encRespPool, buf)
+
+	buf.Reset()
+	if err := json.Indent(buf, src, prefix, indent); err != nil {
+		return nil, err
+	}
+	res := make([]byte, buf.Len())
+	copy(res, buf.Bytes())
+	return res, nil
+}
+
+var compactInputs = map[string]string{
+	"object":  "{\n  \"id\": 1,\n  \"name\": \"Jack\",\n  \"items\": [ \"knife\", \"shield\", \"herbs\" ]\n}\n",
+	"compact": SData,
+	"nested":  "[ { \"a\" : { \"b\" : [ 1 , 2.5 , null , true ] } } , \"s p a c e\" ]",
+	"empty":   " {} ",
+}
+
+func TestCompactJSONWithPool(t *testing.T) {
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		for name, in := range compactInputs {
+			t.Run(name, func(t *testing.T) {
+				var want bytes.Buffer
+				if err := json.Compact(&want, []byte(in)); err != nil {
+					t.Fatal(err)
+				}
+				got, err := CompactJSONWithPool([]byte(in))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want.Bytes()) {
+					t.Errorf("got: %s, want: %s", got, want.Bytes())
+				}
+			})
+		}
+	}
+
+	if _, err := CompactJSONWithPool([]byte(`{"id":`)); err == nil {
+		t.Error("want error for invalid JSON")
+	}
+}
+
+func TestIndentJSONWithPool(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		for name, in := range compactInputs {
+			t.Run(name, func(t *testing.T) {
+				var want bytes.Buffer
+				if err := json.Indent(&want, []byte(in), "> ", "\t"); err != nil {
+					t.Fatal(err)
+				}
+				got, err := IndentJSONWithPool([]byte(in), "> ", "\t")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want.Bytes()) {
+					t.Errorf("got: %s, want: %s", got, want.Bytes())
+				}
+			})
+		}
+	}
+
+	if _, err := IndentJSONWithPool([]byte(`{"id":`), "", "  "); err == nil {
+		t.Error("want error for invalid JSON")
+	}
+
+	// 返り値はPoolのbufとは別のメモリなので、後の呼び出しで書き換わらない
+	first, err := CompactJSONWithPool([]byte(compactInputs["object"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := IndentJSONWithPool([]byte(compactInputs["nested"]), "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	if string(first) != SData {
+		t.Errorf("result changed after another call: %s", first)
+	}
+}
+
+// compactJSON は呼び出しごとにbytes.Bufferを作る、json.Compactのそのままの使い方。比較用
+func compactJSON(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, src); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func benchmarkCompactJSON(b *testing.B, in []byte, compact func([]byte) ([]byte, error)) {
+	b.ReportAllocs()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		r, _ = compact(in)
+	}
+	EncBytesResult = r
+}
+
+func BenchmarkCompactJSON(b *testing.B) {
+	benchmarkCompactJSON(b, []byte(compactInputs["object"]), compactJSON)
+}
+
+func BenchmarkCompactJSONWithPool(b *testing.B) {
+	benchmarkCompactJSON(b, []byte(compactInputs["object"]), CompactJSONWithPool)
+}
+
+// 1000件の配列を字下げしたJSON
+func largeIndentedJSON(b *testing.B) []byte {
+	in, _ := jsonListInput(1000)
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(in), "", "  "); err != nil {
+		b.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkCompactJSONLarge(b *testing.B) {
+	benchmarkCompactJSON(b, largeIndentedJSON(b), compactJSON)
+}
+
+func BenchmarkCompactJSONWithPoolLarge(b *testing.B) {
+	benchmarkCompactJSON(b, largeIndentedJSON(b), CompactJSONWithPool)
+}
+
+// go test -run XX -bench CompactJSON .
+// BenchmarkCompactJSON              	 4487760	       265.2 ns/op	      80 B/op	       1 allocs/op
+// BenchmarkCompactJSONWithPool      	 4524520	       272.3 ns/op	      64 B/op	       1 allocs/op
+// BenchmarkCompactJSONLarge         	    6669	    190325 ns/op	   98373 B/op	       1 allocs/op
+// BenchmarkCompactJSONWithPoolLarge 	    7096	    171069 ns/op	   57410 B/op	       1 allocs/op
+// json.Compactは書き込む前にsrcの長さまでbufをGrowするので、呼び出しごとのbufでも確保は1回だけ
+// Poolを使うと、その1回がsrcの大きさではなく結果の大きさのコピーになる分だけB/opが減る
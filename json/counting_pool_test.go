@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countingPool はNewが呼ばれた回数(Poolに値がなかった回数)を数えるsync.Pool
+// 本番でPoolがどのくらい効いているかを見るためのもの
+// GetとNewの回数はどちらもatomic.Int64のAdd1回で数えるので、本番でも数えたままにする
+type countingPool struct {
+	sync.Pool
+	gets   atomic.Int64
+	misses atomic.Int64
+}
+
+func newCountingPool(newFunc func() interface{}) *countingPool {
+	p := &countingPool{}
+	p.New = func() interface{} {
+		p.misses.Add(1)
+		return newFunc()
+	}
+	return p
+}
+
+func (p *countingPool) Get() interface{} {
+	p.gets.Add(1)
+	return p.Pool.Get()
+}
+
+// Misses はNewが呼ばれた回数を返す
+func (p *countingPool) Misses() int64 {
+	return p.misses.Load()
+}
+
+// NewRate はGetのうちNewが呼ばれた割合を返す。まだGetされていなければ0
+// 1に近いときはPoolがほとんど効いていない
+func (p *countingPool) NewRate() float64 {
+	gets := p.gets.Load()
+	if gets == 0 {
+		return 0
+	}
+	return float64(p.misses.Load()) / float64(gets)
+}
+
+func TestCountingPoolNewRate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	p := newCountingPool(func() interface{} {
+		return &bytes.Buffer{}
+	})
+	if got := p.NewRate(); got != 0 {
+		t.Errorf("NewRate before Get: %v, want: 0", got)
+	}
+
+	// 1つのgoroutineでGetとPutを繰り返すと、最初の1回以外はPoolの値が使われる
+	var prev float64
+	for i := 1; i <= 1000; i++ {
+		p.Put(p.Get())
+		if i%100 == 0 {
+			rate := p.NewRate()
+			if i > 100 && rate > prev {
+				t.Errorf("NewRate increased after %d gets: %v -> %v", i, prev, rate)
+			}
+			prev = rate
+		}
+	}
+	if p.Misses() != 1 {
+		t.Errorf("Misses: %d, want: 1", p.Misses())
+	}
+	if prev > 0.01 {
+		t.Errorf("NewRate after warm-up: %v, want <= 0.01", prev)
+	}
+}
+
+func TestEncRespPoolCounts(t *testing.T) {
+	gets := encRespPool.gets.Load()
+	misses := encRespPool.Misses()
+	for i := 0; i < 3; i++ {
+		if _, err := EncodeJSONStreamWithPool(JData); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := encRespPool.gets.Load() - gets; got != 3 {
+		t.Errorf("gets: %d, want: 3", got)
+	}
+	if got := encRespPool.Misses() - misses; got > 3 {
+		t.Errorf("misses: %d, want <= 3", got)
+	}
+}
+
+// poolDebugでないビルドでもGetを数えるので、NewRateが0(Poolが全て効いている)にならない
+func TestCountingPoolCountsWithoutPoolDebug(t *testing.T) {
+	defer func(d bool) { poolDebug = d }(poolDebug)
+	poolDebug = false
+	p := newCountingPool(func() interface{} {
+		return &bytes.Buffer{}
+	})
+	// Putしないので、Getの度にNewが呼ばれる
+	for i := 0; i < 4; i++ {
+		p.Get()
+	}
+	if got := p.gets.Load(); got != 4 {
+		t.Errorf("gets: %d, want: 4", got)
+	}
+	if got := p.Misses(); got != 4 {
+		t.Errorf("Misses: %d, want: 4", got)
+	}
+	if got := p.NewRate(); got != 1 {
+		t.Errorf("NewRate: %v, want: 1", got)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var bytesReaderPool = &sync.Pool{
+	New: func() interface{} {
+		return bytes.NewReader(nil)
+	},
+}
+
+// DecodeJSONStreamFromBytes はdataのJSONをoutに読み込む
+// []byteをDecodeJSONStreamに渡すには毎回bytes.NewReaderで包む必要があり、そのたびにReaderがallocateされるので、
+// PoolのReaderをResetしてdataに向けて使う
+func DecodeJSONStreamFromBytes(data []byte, out *JsonData) error {
+	r := bytesReaderPool.Get().(*bytes.Reader)
+	r.Reset(data)
+	defer func() {
+		// Poolに戻した後に呼び出し元のdataを参照し続けないようにする
+		r.Reset(nil)
+		bytesReaderPool.Put(r)
+	}()
+
+	d := getJSONDecoder(jsonDecoderPool, r)
+	*out = JsonData{}
+	err := d.dec.Decode(out)
+	putJSONDecoder(d, err)
+	return err
+}
+
+// decodeJSONStreamFromBytesNewReader はDecodeJSONStreamFromBytesと同じだが、毎回bytes.NewReaderを作る
+// ベンチマークの比較用
+func decodeJSONStreamFromBytesNewReader(data []byte, out *JsonData) error {
+	d := getJSONDecoder(jsonDecoderPool, bytes.NewReader(data))
+	*out = JsonData{}
+	err := d.dec.Decode(out)
+	putJSONDecoder(d, err)
+	return err
+}
+
+func TestDecodeJSONStreamFromBytes(t *testing.T) {
+	want := JsonData{
+		ID:    1,
+		Name:  "Jack",
+		Items: []string{"knife", "shield", "herbs"},
+	}
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		var got JsonData
+		if err := DecodeJSONStreamFromBytes([]byte(SData), &got); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("got: %v,want: %v, diff: %s", got, want, diff)
+		}
+
+		// outに前の値が入っていても、入力にないフィールドが残らない
+		got = JsonData{ID: 2, Name: "Bob", Items: []string{"bow"}}
+		if err := DecodeJSONStreamFromBytes([]byte(`{"id":3}`), &got); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(got, JsonData{ID: 3}); diff != "" {
+			t.Errorf("got: %v,want: %v, diff: %s", got, JsonData{ID: 3}, diff)
+		}
+
+		if err := DecodeJSONStreamFromBytes([]byte(`{"id":`), &got); err == nil {
+			t.Error("want error")
+		}
+	}
+
+	// Poolに戻したReaderは呼び出し元のdataを参照していない
+	data := []byte(SData)
+	var got JsonData
+	if err := DecodeJSONStreamFromBytes(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	r := bytesReaderPool.Get().(*bytes.Reader)
+	defer bytesReaderPool.Put(r)
+	if r.Size() != 0 {
+		t.Errorf("pooled reader still references data: size %d", r.Size())
+	}
+}
+
+func TestDecodeJSONStreamFromBytesAllocs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	data := []byte(SData)
+	var out JsonData
+	pooled := testing.AllocsPerRun(100, func() {
+		DecodeJSONStreamFromBytes(data, &out)
+	})
+	naive := testing.AllocsPerRun(100, func() {
+		decodeJSONStreamFromBytesNewReader(data, &out)
+	})
+	if pooled >= naive {
+		t.Errorf("pooled reader allocs: %v, bytes.NewReader allocs: %v", pooled, naive)
+	}
+}
+
+func BenchmarkDecodeJSONStreamFromBytes(b *testing.B) {
+	data := []byte(SData)
+	b.ReportAllocs()
+	var r JsonData
+	for n := 0; n < b.N; n++ {
+		DecodeJSONStreamFromBytes(data, &r)
+	}
+	DecResult = r
+}
+
+func BenchmarkDecodeJSONStreamFromBytesNewReader(b *testing.B) {
+	data := []byte(SData)
+	b.ReportAllocs()
+	var r JsonData
+	for n := 0; n < b.N; n++ {
+		decodeJSONStreamFromBytesNewReader(data, &r)
+	}
+	DecResult = r
+}
+
+// go test -run XX -bench FromBytes .
+// BenchmarkDecodeJSONStreamFromBytes          	 1000000	      1226 ns/op	     112 B/op	       3 allocs/op
+// BenchmarkDecodeJSONStreamFromBytesNewReader 	 1000000	      1255 ns/op	     160 B/op	       4 allocs/op
+// bytes.Readerの分の1 alloc(48B)が減る。残りの3 allocsはJsonDataのNameとItemsの中身
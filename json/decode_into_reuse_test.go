@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// copyInto はdをoutにコピーする。Cloneと違い、ItemsはoutのItemsの配列に上書きする
+// json.Unmarshalも既存のsliceの容量を使い回す(長さを0にしてappendする)ので、
+// Poolのresにデコードする部分ではもともとItemsの配列は作り直されていない。作り直していたのはCloneだけ
+// Itemsがnilのときはnilのまま、空のときは空のsliceにして、Cloneと同じ結果にする
+func (d *JsonData) copyInto(out *JsonData) {
+	items := out.Items
+	*out = *d
+	if d.Items == nil {
+		return
+	}
+	out.Items = append(items[:0], d.Items...)
+	if out.Items == nil {
+		out.Items = []string{}
+	}
+}
+
+// decodeJSONIntoClone はcopyIntoを使う前のDecodeJSONInto。毎回Cloneで新しいItemsの配列を作る。比較用
+func decodeJSONIntoClone(in string, out *JsonData) error {
+	res := verifiedDecRespPool.Get()
+	defer verifiedDecRespPool.Put(res)
+
+	*res = JsonData{Items: res.Items[:0]}
+	if err := json.Unmarshal([]byte(in), res); err != nil {
+		return err
+	}
+	*out = res.Clone()
+	return nil
+}
+
+func TestDecodeJSONIntoReusesItems(t *testing.T) {
+	// outのItemsの配列を使い回しても、PoolのJsonDataと配列を共有していないことをverifiedJSONDataPoolで確かめる
+	enableVerifiedDecRespPool(t)
+
+	var out JsonData
+	if err := DecodeJSONInto(SData, &out); err != nil {
+		t.Fatal(err)
+	}
+	first := &out.Items[0]
+
+	// 同じ長さのItemsなら、何回デコードしてもoutのItemsの配列はそのまま
+	for i := 0; i < 3; i++ {
+		if err := DecodeJSONInto(SData, &out); err != nil {
+			t.Fatal(err)
+		}
+		if &out.Items[0] != first {
+			t.Errorf("%d: Items backing array was reallocated", i)
+		}
+	}
+
+	tests := map[string]struct {
+		in   string
+		want []string
+	}{
+		"empty_items": {in: `{"id":1,"items":[]}`, want: []string{}},
+		"shorter":     {in: `{"id":1,"items":["x"]}`, want: []string{"x"}},
+		"longer":      {in: `{"id":1,"items":["a","b","c","d","e"]}`, want: []string{"a", "b", "c", "d", "e"}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			out := JsonData{Items: []string{"a", "b", "c", "d"}}
+			if err := DecodeJSONInto(tc.in, &out); err != nil {
+				t.Fatal(err)
+			}
+			if out.Items == nil || len(out.Items) != len(tc.want) {
+				t.Fatalf("got: %#v, want: %#v", out.Items, tc.want)
+			}
+			for i := range tc.want {
+				if out.Items[i] != tc.want[i] {
+					t.Errorf("got: %q, want: %q", out.Items, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeJSONIntoItemsAllocs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	// inを[]byteにするallocsはどちらにもあるので、Cloneの実装との差でItemsの配列のallocsを見る
+	var out JsonData
+	measure := func(decode func(string, *JsonData) error) float64 {
+		return testing.AllocsPerRun(100, func() {
+			if err := decode(SData, &out); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	before := measure(decodeJSONIntoClone)
+	after := measure(DecodeJSONInto)
+	if before-after != 1 {
+		t.Errorf("allocs before: %v, after: %v, want 1 fewer alloc for Items", before, after)
+	}
+}
+
+func benchmarkDecodeJSONIntoLoop(b *testing.B, decode func(string, *JsonData) error) {
+	var out JsonData
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if err := decode(SData, &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+	DecResult = out
+}
+
+func BenchmarkDecodeJSONIntoClone(b *testing.B) {
+	benchmarkDecodeJSONIntoLoop(b, decodeJSONIntoClone)
+}
+
+func BenchmarkDecodeJSONIntoReuse(b *testing.B) {
+	benchmarkDecodeJSONIntoLoop(b, DecodeJSONInto)
+}
+
+// go test -run XX -bench DecodeJSONInto .
+// BenchmarkDecodeJSONIntoClone 	 1696196	       746.4 ns/op	     112 B/op	       2 allocs/op
+// BenchmarkDecodeJSONIntoReuse 	 1726246	       712.6 ns/op	      64 B/op	       1 allocs/op
+// Itemsの配列の1 allocsがなくなる。残りの1 allocs(64 B)はinを[]byteにする変換の分
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var ErrInputTooLarge = errors.New("input too large")
+
+// DecodeJSONLimited はrから最大maxBytesまで読んでoutにデコードする
+// maxBytesを超える大きさのJSONが来たら、それ以上読まずにErrInputTooLargeを返す
+// 超えたかどうかを区別するために1バイトだけ余分に読めるようにしておき、
+// デコードが失敗したときに余分な1バイトまで読んでいたら、またはデコードした値の終わりがmaxBytesを超えていたら超過とする
+// ErrInputTooLargeを返したときのoutは途中までしか埋まっていないことがある
+func DecodeJSONLimited(r io.Reader, maxBytes int64, out *JsonData) error {
+	lr := &io.LimitedReader{R: r, N: maxBytes + 1}
+	d := getJSONDecoder(jsonDecoderPool, lr)
+	err := d.dec.Decode(out)
+	if (err != nil && lr.N == 0) || (err == nil && d.InputOffset() > maxBytes) {
+		err = fmt.Errorf("%w: limit %d bytes", ErrInputTooLarge, maxBytes)
+	}
+	// rはメモリ上とは限らないので、エラーのときはDecoderを捨てる
+	putJSONDecoder(d, err)
+	return err
+}
+
+func TestDecodeJSONLimited(t *testing.T) {
+	valid := `{"id":1,"name":"Jack","items":["knife","shield","herbs"]}`
+	want := JsonData{
+		ID:    1,
+		Name:  "Jack",
+		Items: []string{"knife", "shield", "herbs"},
+	}
+	limit := int64(len(valid))
+
+	tests := map[string]struct {
+		in      string
+		want    JsonData
+		wantErr error
+	}{
+		"small":          {`{"id":2}`, JsonData{ID: 2}, nil},
+		"exactly_limit":  {valid, want, nil},
+		"trailing_space": {valid + "\n", want, nil},
+		"one_over_limit": {`{"id":10,"name":"Jack","items":["knife","shield","herbs"]}`, JsonData{}, ErrInputTooLarge},
+		"far_over_limit": {`{"id":1,"name":"` + strings.Repeat("a", 1000) + `"}`, JsonData{}, ErrInputTooLarge},
+		"truncated":      {`{"id":1,"name":`, JsonData{}, io.ErrUnexpectedEOF},
+	}
+
+	// エラーの後もPoolのDecoderが正しく使えることを確認するため、2回実行している
+	for i := 0; i < 2; i++ {
+		for name, tt := range tests {
+			t.Run(name, func(t *testing.T) {
+				var got JsonData
+				err := DecodeJSONLimited(strings.NewReader(tt.in), limit, &got)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error: %v, want: %v", err, tt.wantErr)
+				}
+				if err != nil {
+					return
+				}
+				if diff := cmp.Diff(got, tt.want); diff != "" {
+					t.Errorf("got: %v,want: %v, diff: %s", got, tt.want, diff)
+				}
+			})
+		}
+	}
+
+	// 大きすぎる入力は上限+1バイトまでしか読まない
+	r := strings.NewReader(`{"name":"` + strings.Repeat("a", 100000) + `"}`)
+	var got JsonData
+	if err := DecodeJSONLimited(r, limit, &got); !errors.Is(err, ErrInputTooLarge) {
+		t.Fatalf("got error: %v, want: %v", err, ErrInputTooLarge)
+	}
+	if read := r.Size() - int64(r.Len()); read != limit+1 {
+		t.Errorf("read %d bytes, want: %d", read, limit+1)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var errNotJSONArray = errors.New("input is not a JSON array")
+
+// DecodeJSONListで要素を貯めていくSliceのPool
+// 要素数が多いとappendで何度も配列を確保し直すので、前に伸ばした配列を使いまわす
+var jsonListPool = &sync.Pool{
+	New: func() interface{} {
+		return &[]JsonData{}
+	},
+}
+
+// DecodeJSONList はJSONの配列inを[]JsonDataにする
+// 返り値はPoolの配列からコピーしたものなので、呼び出し側のものとして自由に使ってよい
+func DecodeJSONList(in string) ([]JsonData, error) {
+	d := getJSONDecoder(jsonDecoderPool, strings.NewReader(in))
+	list := jsonListPool.Get().(*[]JsonData)
+	defer func() {
+		// Poolに戻した配列が要素のItemsなどを参照し続けないようにゼロ値にしておく
+		clear(*list)
+		*list = (*list)[:0]
+		jsonListPool.Put(list)
+	}()
+	*list = (*list)[:0]
+
+	err := decodeJSONList(d.dec, list)
+	putJSONDecoder(d, err)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]JsonData, len(*list))
+	copy(res, *list)
+	return res, nil
+}
+
+func decodeJSONList(dec *json.Decoder, list *[]JsonData) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("%w: got %v", errNotJSONArray, tok)
+	}
+	for dec.More() {
+		// 配列の前の値が残っているかもしれないので、ゼロ値を追加してからそこにDecodeする
+		*list = append(*list, JsonData{})
+		if err := dec.Decode(&(*list)[len(*list)-1]); err != nil {
+			return err
+		}
+	}
+	// 閉じ括弧の']'を読む
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func jsonListInput(n int) (string, []JsonData) {
+	var sb strings.Builder
+	want := make([]JsonData, n)
+	sb.WriteByte('[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		want[i] = JsonData{ID: i, Name: fmt.Sprintf("name%d", i), Items: []string{"knife", "shield"}}
+		fmt.Fprintf(&sb, `{"id":%d,"name":"name%d","items":["knife","shield"]}`, i, i)
+	}
+	sb.WriteByte(']')
+	return sb.String(), want
+}
+
+func TestDecodeJSONList(t *testing.T) {
+	in := `[
+		{"id":1,"name":"Jack","items":["knife","shield","herbs"]},
+		{"id":2,"name":"Emma"},
+		{"id":3,"name":"Liam","items":["bow"]}
+	]`
+	want := []JsonData{
+		{ID: 1, Name: "Jack", Items: []string{"knife", "shield", "herbs"}},
+		{ID: 2, Name: "Emma"},
+		{ID: 3, Name: "Liam", Items: []string{"bow"}},
+	}
+
+	var results [][]JsonData
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		got, err := DecodeJSONList(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("got: %v,want: %v, diff: %s", got, want, diff)
+		}
+		results = append(results, got)
+	}
+	// 返り値はPoolの配列からコピーしているので、前の呼び出しの結果は書き換えられない
+	if diff := cmp.Diff(results[0], want); diff != "" {
+		t.Errorf("first result was modified: %s", diff)
+	}
+
+	large, wantLarge := jsonListInput(100)
+	gotLarge, err := DecodeJSONList(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(gotLarge, wantLarge); diff != "" {
+		t.Errorf("100 elements: diff: %s", diff)
+	}
+
+	got, err := DecodeJSONList(`[]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got: %v, want empty", got)
+	}
+
+	if _, err := DecodeJSONList(`{"id":1}`); !errors.Is(err, errNotJSONArray) {
+		t.Errorf("got: %v, want: %v", err, errNotJSONArray)
+	}
+	if _, err := DecodeJSONList(`[{"id":1},`); err == nil {
+		t.Error("want error for truncated input")
+	}
+}
+
+var ListResult []JsonData
+
+// go test -run XX -bench JSONList .
+// BenchmarkDecodeJSONList          	   10604	    134350 ns/op	   10468 B/op	     302 allocs/op
+// BenchmarkDecodeJSONListUnmarshal 	    9408	    118012 ns/op	   26644 B/op	     309 allocs/op
+// 配列を伸ばし直す分のメモリは減るが、要素ごとのNameやItemsのアロケーションはどちらも同じだけある
+
+func BenchmarkDecodeJSONList(b *testing.B) {
+	in, _ := jsonListInput(100)
+	b.ReportAllocs()
+	var r []JsonData
+	for n := 0; n < b.N; n++ {
+		r, _ = DecodeJSONList(in)
+	}
+	ListResult = r
+}
+
+func BenchmarkDecodeJSONListUnmarshal(b *testing.B) {
+	in, _ := jsonListInput(100)
+	b.ReportAllocs()
+	var r []JsonData
+	for n := 0; n < b.N; n++ {
+		r = nil
+		_ = json.Unmarshal([]byte(in), &r)
+	}
+	ListResult = r
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// DecodeJSONMapOptions はDecodeJSONMapの設定
+type DecodeJSONMapOptions struct {
+	// UseNumber がtrueなら数値をfloat64ではなくjson.Numberで返す
+	// float64では2^53を超える整数が正確に表せないので、IDなど大きい整数を扱うときに使う
+	UseNumber bool
+}
+
+var numberJSONDecoderPool = newJSONDecoderPool(func(dec *json.Decoder) {
+	dec.UseNumber()
+})
+
+// DecodeJSONMap はJSONのオブジェクトを構造体を決めずにmapとして読む
+// UseNumberの設定は後から解除できないので、設定ごとに別のPoolのDecoderを使う
+func DecodeJSONMap(in string, opts DecodeJSONMapOptions) (map[string]interface{}, error) {
+	pool := jsonDecoderPool
+	if opts.UseNumber {
+		pool = numberJSONDecoderPool
+	}
+	d := getJSONDecoder(pool, strings.NewReader(in))
+	var res map[string]interface{}
+	err := d.dec.Decode(&res)
+	putJSONDecoder(d, err)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func TestDecodeJSONMapUseNumber(t *testing.T) {
+	// 2^53+1はfloat64では2^53に丸められてしまう
+	const in = `{"id":9007199254740993,"name":"Jack"}`
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、UseNumberありとなしを交互に２回実行している
+	for i := 0; i < 2; i++ {
+		got, err := DecodeJSONMap(in, DecodeJSONMapOptions{UseNumber: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		num, ok := got["id"].(json.Number)
+		if !ok {
+			t.Fatalf("got: %T, want: json.Number", got["id"])
+		}
+		if num.String() != "9007199254740993" {
+			t.Errorf("got: %s, want: %s", num, "9007199254740993")
+		}
+		id, err := num.Int64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != 9007199254740993 {
+			t.Errorf("got: %d, want: %d", id, int64(9007199254740993))
+		}
+		if got["name"] != "Jack" {
+			t.Errorf("got: %v, want: %s", got["name"], "Jack")
+		}
+
+		// UseNumberなしではfloat64になり、値が変わってしまう
+		got, err = DecodeJSONMap(in, DecodeJSONMapOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, ok := got["id"].(float64)
+		if !ok {
+			t.Fatalf("got: %T, want: float64", got["id"])
+		}
+		if int64(f) == 9007199254740993 {
+			t.Errorf("float64 unexpectedly kept the value: %v", f)
+		}
+	}
+
+	if _, err := DecodeJSONMap(`{"id":`, DecodeJSONMapOptions{UseNumber: true}); err == nil {
+		t.Error("want error")
+	}
+}
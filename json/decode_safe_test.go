@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Clone はItemsを新しいSliceにコピーしたJsonDataを返す
+// JsonDataをそのままコピーしてもItemsは同じ配列を指したままなので、
+// Poolのオブジェクトから値を返すときはCloneしてから返す
+func (d JsonData) Clone() JsonData {
+	if d.Items != nil {
+		items := make([]string, len(d.Items))
+		copy(items, d.Items)
+		d.Items = items
+	}
+	return d
+}
+
+// DecodeJSONWithPoolSafe はDecodeJSONWithPoolと同じくPoolのJsonDataにデコードするが、
+// Cloneしてから返すので、返り値のItemsがPoolのオブジェクトと配列を共有しない
+// 入力にないフィールドに前の値が残らないように、decRespPoolがGetでResetしている
+func DecodeJSONWithPoolSafe(in string) (JsonData, error) {
+	res := decRespPool.Get()
+	defer decRespPool.Put(res)
+
+	if err := json.Unmarshal([]byte(in), res); err != nil {
+		return JsonData{}, err
+	}
+	return res.Clone(), nil
+}
+
+func TestJsonDataClone(t *testing.T) {
+	d := JsonData{ID: 1, Name: "Jack", Items: []string{"knife", "shield"}}
+	c := d.Clone()
+	c.Items[0] = "sword"
+	if d.Items[0] != "knife" {
+		t.Errorf("Clone shares Items with the original: %v", d.Items)
+	}
+	if got := (JsonData{ID: 1}).Clone(); got.Items != nil {
+		t.Errorf("got: %v, want nil Items", got.Items)
+	}
+}
+
+func TestDecodeJSONWithPoolSafe(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		got, err := DecodeJSONWithPoolSafe(SData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(got, JData); diff != "" {
+			t.Errorf("got: %v,want: %v, diff: %s", got, JData, diff)
+		}
+	}
+
+	// 前にデコードした値が残らない
+	got, err := DecodeJSONWithPoolSafe(`{"items":["herbs"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (JsonData{Items: []string{"herbs"}}); !cmp.Equal(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+// go test -race で実行すると、返り値のItemsがPoolと配列を共有している場合にdata raceとして検出される
+func TestDecodeJSONWithPoolSafeRace(t *testing.T) {
+	const goroutines = 4
+	const runs = 200
+
+	var wg sync.WaitGroup
+	errc := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < runs; i++ {
+				in := fmt.Sprintf(`{"id":%d,"name":"g%d","items":["a","b","c"]}`, i, g)
+				got, err := DecodeJSONWithPoolSafe(in)
+				if err != nil {
+					errc <- err
+					return
+				}
+				// 他のgoroutineがデコードしている間に返り値を書き換える
+				for j := range got.Items {
+					got.Items[j] = "mutated"
+				}
+				if got.ID != i || got.Name != fmt.Sprintf("g%d", g) {
+					errc <- fmt.Errorf("got: %v, want id %d name g%d", got, i, g)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		t.Error(err)
+	}
+}
+
+func BenchmarkDecodeJSONWithPoolSafe(b *testing.B) {
+	b.ReportAllocs()
+	var r JsonData
+	for n := 0; n < b.N; n++ {
+		r, _ = DecodeJSONWithPoolSafe(SData)
+	}
+	DecResult = r
+}
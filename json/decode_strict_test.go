@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// DecodeJSONStrict はJsonDataにないキーが入力に含まれていたらエラーを返す
+// 受け取ったデータのバリデーション用。DecodeJSONはこれまで通り知らないキーを無視する
+func DecodeJSONStrict(in string, out *JsonData) error {
+	d := getJSONDecoder(strictJSONDecoderPool, strings.NewReader(in))
+	err := d.dec.Decode(out)
+	if decoderBroken(err) {
+		putJSONDecoder(d, err)
+	} else {
+		// unknown fieldのエラーでもDecoderはPoolに戻す
+		putJSONDecoder(d, nil)
+	}
+	return err
+}
+
+func TestDecodeJSONStrict(t *testing.T) {
+	want := JsonData{
+		ID:    1,
+		Name:  "Jack",
+		Items: []string{"knife", "shield", "herbs"},
+	}
+
+	// エラーの後もPoolのDecoderが正しく使えることを確認するため、交互に実行している
+	for i := 0; i < 3; i++ {
+		t.Run("clean", func(t *testing.T) {
+			var got JsonData
+			if err := DecodeJSONStrict(`{"id":1,"name":"Jack","items":["knife","shield","herbs"]}`, &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("got: %v,want: %v, diff: %s", got, want, diff)
+			}
+		})
+		t.Run("unknown_field", func(t *testing.T) {
+			var got JsonData
+			err := DecodeJSONStrict(`{"id":1,"name":"Jack","extra":true,"items":["knife"]}`, &got)
+			if err == nil || !strings.Contains(err.Error(), `unknown field "extra"`) {
+				t.Errorf("got: %v, want unknown field error", err)
+			}
+		})
+		t.Run("syntax_error", func(t *testing.T) {
+			var got JsonData
+			if err := DecodeJSONStrict(`{"id":1,`, &got); err == nil {
+				t.Error("want error")
+			}
+		})
+	}
+
+	// DecodeJSONは知らないキーを無視する
+	got, err := DecodeJSON(`{"id":1,"name":"Jack","extra":true,"items":["knife","shield","herbs"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got: %v,want: %v, diff: %s", got, want, diff)
+	}
+}
+
+func TestStrictJSONDecoderReusableAfterUnknownField(t *testing.T) {
+	// unknown fieldのエラーの後でも、同じDecoderで次の値を読める
+	d := getJSONDecoder(strictJSONDecoderPool, strings.NewReader(`{"extra":true} {"id":2}`))
+	var v JsonData
+	err := d.dec.Decode(&v)
+	if err == nil {
+		t.Fatal("want unknown field error")
+	}
+	if decoderBroken(err) {
+		t.Fatalf("decoderBroken(%v) = true, want false", err)
+	}
+	if err := d.dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.ID != 2 {
+		t.Errorf("got: %d, want: %d", v.ID, 2)
+	}
+}
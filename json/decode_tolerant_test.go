@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// UTF-8のBOM。Windowsのツールなどで作ったJSONの先頭に付いていることがある
+const utf8BOM = "\xef\xbb\xbf"
+
+// DecodeJSONTolerant は先頭のBOMと前後の空白を取り除いてからinをoutに読み込む
+// json.Unmarshalもjson.DecoderもBOMを不正な文字としてエラーにするので、
+// BOM付きのJSONを送ってくる相手から受け取るときに使う
+func DecodeJSONTolerant(in string, out *JsonData) error {
+	in = strings.TrimSpace(in)
+	in = strings.TrimPrefix(in, utf8BOM)
+	in = strings.TrimSpace(in)
+
+	d := getJSONDecoder(jsonDecoderPool, strings.NewReader(in))
+	err := d.dec.Decode(out)
+	if decoderBroken(err) {
+		putJSONDecoder(d, err)
+	} else {
+		putJSONDecoder(d, nil)
+	}
+	return err
+}
+
+func TestDecodeJSONTolerant(t *testing.T) {
+	encoded := `{"id":1,"name":"Jack","items":["knife","shield","herbs"]}`
+	want := JsonData{
+		ID:    1,
+		Name:  "Jack",
+		Items: []string{"knife", "shield", "herbs"},
+	}
+
+	inputs := map[string]string{
+		"plain":           encoded,
+		"bom":             utf8BOM + encoded,
+		"bom_and_spaces":  utf8BOM + "\n  " + encoded + "\r\n",
+		"leading_spaces":  " \t\n" + encoded,
+		"spaces_then_bom": "  " + utf8BOM + encoded,
+	}
+
+	// BOM付きのJSONはjson.Unmarshalではエラーになる
+	var res JsonData
+	if err := json.Unmarshal([]byte(inputs["bom"]), &res); err == nil {
+		t.Fatal("json.Unmarshal accepted a BOM-prefixed payload")
+	}
+
+	// PoolのDecoderを使い回しても前の入力の影響を受けないことを確認するため、複数回実行する
+	for i := 0; i < 2; i++ {
+		for name, in := range inputs {
+			t.Run(name, func(t *testing.T) {
+				var got JsonData
+				if err := DecodeJSONTolerant(in, &got); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(got, want); diff != "" {
+					t.Errorf("got: %v,want: %v, diff: %s", got, want, diff)
+				}
+			})
+		}
+	}
+
+	var got JsonData
+	if err := DecodeJSONTolerant(utf8BOM+`{"id":1,`, &got); err == nil {
+		t.Error("want error for truncated input")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// エラーの前後に付ける入力のバイト数
+const verboseSnippetLen = 16
+
+// DecodeJSONVerbose はDecodeJSONと同じくinをoutに読み込むが、
+// 失敗したときに入力のどこで失敗したか(バイトオフセットと前後の入力)をエラーに付け加える
+// 元のエラーはerrors.As/errors.Isで取り出せる
+func DecodeJSONVerbose(in string, out *JsonData) error {
+	d := getJSONDecoder(jsonDecoderPool, strings.NewReader(in))
+	start := d.start
+	err := d.dec.Decode(out)
+	if err == nil {
+		putJSONDecoder(d, nil)
+		return nil
+	}
+
+	offset := d.InputOffset()
+	var se *json.SyntaxError
+	var te *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &se):
+		// SyntaxError.OffsetはDecoderが前の入力から通算して読んだ位置なので、今回の入力の先頭の分を引く
+		offset = se.Offset - start
+	case errors.As(err, &te):
+		// UnmarshalTypeError.Offsetは今回の値の先頭からの位置になっている
+		offset = te.Offset
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		// 途中で入力が終わったときは末尾を示す
+		offset = int64(len(in))
+	}
+	if decoderBroken(err) {
+		putJSONDecoder(d, err)
+	} else {
+		putJSONDecoder(d, nil)
+	}
+	return fmt.Errorf("%w (offset %d, near %q)", err, offset, snippetAround(in, offset))
+}
+
+// snippetAround はinのoffsetの前後verboseSnippetLenバイトを返す
+func snippetAround(in string, offset int64) string {
+	from := max(0, int(offset)-verboseSnippetLen)
+	to := min(len(in), int(offset)+verboseSnippetLen)
+	if from > to {
+		from = to
+	}
+	return in[from:to]
+}
+
+func TestDecodeJSONVerbose(t *testing.T) {
+	want := JsonData{
+		ID:    1,
+		Name:  "Jack",
+		Items: []string{"knife", "shield", "herbs"},
+	}
+
+	// PoolのDecoderを使い回したときにオフセットがずれないことを確認するため、成功と失敗を交互に複数回実行する
+	for i := 0; i < 3; i++ {
+		t.Run("ok", func(t *testing.T) {
+			var got JsonData
+			if err := DecodeJSONVerbose(`{"id":1,"name":"Jack","items":["knife","shield","herbs"]}  `, &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("got: %v,want: %v, diff: %s", got, want, diff)
+			}
+		})
+		t.Run("syntax_error", func(t *testing.T) {
+			var got JsonData
+			// "knife"と"shield"の間のカンマがない
+			err := DecodeJSONVerbose(`{"id":1,"name":"Jack","items":["knife" "shield","herbs"]}`, &got)
+			var se *json.SyntaxError
+			if !errors.As(err, &se) {
+				t.Fatalf("got: %v, want *json.SyntaxError", err)
+			}
+			for _, want := range []string{"offset 40", `near "tems\":[\"knife\" \"shield\",\"herbs\"]"`} {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("got: %s, want it to contain %s", err, want)
+				}
+			}
+		})
+		t.Run("type_error", func(t *testing.T) {
+			var got JsonData
+			err := DecodeJSONVerbose(`{"id":"one","name":"Jack"}`, &got)
+			var te *json.UnmarshalTypeError
+			if !errors.As(err, &te) {
+				t.Fatalf("got: %v, want *json.UnmarshalTypeError", err)
+			}
+			if !strings.Contains(err.Error(), `offset 11, near "{\"id\":\"one\",\"name\":\"Jack\"}"`) {
+				t.Errorf("got: %s, want offset and snippet", err)
+			}
+		})
+		t.Run("unexpected_eof", func(t *testing.T) {
+			var got JsonData
+			err := DecodeJSONVerbose(`{"id":1,"name":"Ja`, &got)
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("got: %v, want %v", err, io.ErrUnexpectedEOF)
+			}
+			if !strings.Contains(err.Error(), `offset 18, near "id\":1,\"name\":\"Ja"`) {
+				t.Errorf("got: %s, want offset and snippet", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// EncodeJSONBytesWithPool はEncodeJSONStreamWithPoolの[]byteを返す版
+// 返り値はPoolのbufからコピーしたSliceなので、Poolに戻した後も呼び出し側で自由に使ってよい
+// []byteで扱いたい呼び出し側は、stringへの変換とそこからの[]byteへの変換のコピーを省ける
+func EncodeJSONBytesWithPool(in JsonData) ([]byte, error) {
+	buf := encRespPool.Get().(*bytes.Buffer)
+	defer putUnlessPanic(encRespPool, buf)
+
+	buf.Reset()
+	if err := json.NewEncoder(buf).Encode(in); err != nil {
+		return nil, err
+	}
+	// Encodeが最後に付ける改行は除く
+	b := bytes.TrimRight(buf.Bytes(), "\n")
+	res := make([]byte, len(b))
+	copy(res, b)
+	return res, nil
+}
+
+func TestEncodeJSONBytesWithPool(t *testing.T) {
+	want := `{"id":1,"name":"Jack","items":["knife","shield","herbs"]}`
+
+	var results [][]byte
+	for i := 0; i < 2; i++ {
+		got, err := EncodeJSONBytesWithPool(JData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("got: %s, want: %s", got, want)
+		}
+		results = append(results, got)
+	}
+
+	// 返り値はPoolのbufとは別のメモリなので、後のEncodeで書き換わらない
+	if _, err := EncodeJSONBytesWithPool(JsonData{ID: 2, Name: "Jill"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if string(r) != want {
+			t.Errorf("result changed after another encode: %s", r)
+		}
+	}
+}
+
+// EncodeJSONStreamWithPoolの結果を[]byteに変換すると1回分アロケーションが増える
+// BenchmarkEncodeJSONBytesWithPool                 1895330               615.9 ns/op           160 B/op          3 allocs/op
+// BenchmarkEncodeJSONStreamWithPoolToBytes         1722626               651.8 ns/op           224 B/op          4 allocs/op
+// BenchmarkEncodeJSONStreamWithPool                1909582               670.2 ns/op           160 B/op          3 allocs/op
+var EncBytesResult []byte
+
+func BenchmarkEncodeJSONBytesWithPool(b *testing.B) {
+	b.ReportAllocs()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		r, _ = EncodeJSONBytesWithPool(JData)
+	}
+	EncBytesResult = r
+}
+
+// EncodeJSONStreamWithPoolの結果を[]byteとして使う呼び出し側の場合
+func BenchmarkEncodeJSONStreamWithPoolToBytes(b *testing.B) {
+	b.ReportAllocs()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		s, _ := EncodeJSONStreamWithPool(JData)
+		r = []byte(s)
+	}
+	EncBytesResult = r
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type jsonReadCloser struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+// Close はEncodeが終わるのを待ってからEncoderをPoolに戻す
+// 途中で読むのをやめた場合も、PipeReaderを閉じればEncode側の書き込みがエラーで終わる
+func (r *jsonReadCloser) Close() error {
+	err := r.PipeReader.Close()
+	<-r.done
+	return err
+}
+
+// EncodeJSONReader はinをJSONにしたものを読み出せるReaderを返す
+// 呼び出し側でJSON全体の[]byteを持たずに、そのままRequest Bodyなどに流し込める
+// 読み終わったら必ずCloseすること
+func EncodeJSONReader(in JsonData) io.ReadCloser {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e := getJSONEncoder(pw)
+		err := e.enc.Encode(in)
+		putJSONEncoder(e, err)
+		pw.CloseWithError(err)
+	}()
+	return &jsonReadCloser{
+		PipeReader: pr,
+		done:       done,
+	}
+}
+
+// 一度に数バイトずつしか読めないReader
+type smallChunkReader struct {
+	r io.Reader
+	n int
+}
+
+func (s *smallChunkReader) Read(p []byte) (int, error) {
+	if len(p) > s.n {
+		p = p[:s.n]
+	}
+	return s.r.Read(p)
+}
+
+func TestEncodeJSONReader(t *testing.T) {
+	data := JsonData{
+		ID:    1,
+		Name:  "Jack",
+		Items: []string{"knife", "shield", "herbs"},
+	}
+	for i := 0; i < 1000; i++ {
+		data.Items = append(data.Items, "item")
+	}
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		t.Run("EncodeJSONReader", func(t *testing.T) {
+			r := EncodeJSONReader(data)
+			defer r.Close()
+
+			got, err := DecodeJSONStream(&smallChunkReader{r: r, n: 7})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, data); diff != "" {
+				t.Errorf("got: %v,want: %v, diff: %s", got, data, diff)
+			}
+		})
+	}
+
+	t.Run("CloseBeforeEOF", func(t *testing.T) {
+		r := EncodeJSONReader(data)
+		buf := make([]byte, 10)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(`{"id":1,"name":"Jack"`, string(buf)) {
+			t.Errorf("got: %s", string(buf))
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// EncodeJSONWithKeys はJsonDataのキー名をkeysで置き換えてJSONにする
+// keysは元のキー名("id", "name", "items")から新しいキー名へのmapで、
+// keysにないキーは元のキー名のままにする
+// キーの順番はkeysの内容に関係なく、常にJsonDataのフィールドの順番(id, name, items)になる
+func EncodeJSONWithKeys(in JsonData, keys map[string]string) (string, error) {
+	buf := encRespPool.Get().(*bytes.Buffer)
+	defer encRespPool.Put(buf)
+	buf.Reset()
+
+	e := getJSONEncoder(buf)
+	err := encodeJSONDataWithKeys(e, buf, in, keys)
+	putJSONEncoder(e, err)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func encodeJSONDataWithKeys(e *jsonEncoder, buf *bytes.Buffer, in JsonData, keys map[string]string) error {
+	fields := []struct {
+		key   string
+		value interface{}
+	}{
+		{"id", in.ID},
+		{"name", in.Name},
+		{"items", in.Items},
+	}
+
+	seen := make(map[string]bool, len(fields))
+	buf.WriteByte('{')
+	for i, f := range fields {
+		key := f.key
+		if k, ok := keys[f.key]; ok {
+			key = k
+		}
+		if seen[key] {
+			return fmt.Errorf("duplicate key: %s", key)
+		}
+		seen[key] = true
+
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := encodeJSONValue(e, buf, key); err != nil {
+			return err
+		}
+		buf.WriteByte(':')
+		if err := encodeJSONValue(e, buf, f.value); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// encodeJSONValue はvをbufに書き込む
+// Encodeは最後に改行を付けるので、それを取り除く
+func encodeJSONValue(e *jsonEncoder, buf *bytes.Buffer, v interface{}) error {
+	if err := e.enc.Encode(v); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+func TestEncodeJSONWithKeys(t *testing.T) {
+	data := JsonData{
+		ID:    1,
+		Name:  "Jack",
+		Items: []string{"knife", "shield", "herbs"},
+	}
+
+	tests := map[string]struct {
+		keys    map[string]string
+		want    string
+		wantErr bool
+	}{
+		"remap_all": {
+			keys: map[string]string{"id": "ID", "name": "fullName", "items": "inventory"},
+			want: `{"ID":1,"fullName":"Jack","inventory":["knife","shield","herbs"]}`,
+		},
+		"remap_partial": {
+			keys: map[string]string{"name": "user_name"},
+			want: `{"id":1,"user_name":"Jack","items":["knife","shield","herbs"]}`,
+		},
+		"nil_keys": {
+			keys: nil,
+			want: `{"id":1,"name":"Jack","items":["knife","shield","herbs"]}`,
+		},
+		"escape_key": {
+			keys: map[string]string{"id": `"quoted"`},
+			want: `{"\"quoted\"":1,"name":"Jack","items":["knife","shield","herbs"]}`,
+		},
+		"duplicate_key": {
+			keys:    map[string]string{"id": "name"},
+			wantErr: true,
+		},
+	}
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		for name, tt := range tests {
+			t.Run(name, func(t *testing.T) {
+				got, err := EncodeJSONWithKeys(data, tt.keys)
+				if tt.wantErr {
+					if err == nil {
+						t.Errorf("want error, got: %s", got)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want {
+					t.Errorf("got: %s, want: %s", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkEncodeJSONWithKeys(b *testing.B) {
+	keys := map[string]string{"id": "ID", "name": "fullName", "items": "inventory"}
+	b.ReportAllocs()
+	var r string
+	for n := 0; n < b.N; n++ {
+		r, _ = EncodeJSONWithKeys(JData, keys)
+	}
+	EncResult = r
+}
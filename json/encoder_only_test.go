@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// EncodeJSONStreamのアロケーションがどこから来ているかを調べるための、Poolの使い方を変えた版
+
+// encodeJSONStreamWithEncoderPool はjson.EncoderだけPoolから取り、bufは毎回作る
+func encodeJSONStreamWithEncoderPool(in JsonData) (string, error) {
+	var buf bytes.Buffer
+	e := getJSONEncoder(&buf)
+	err := e.enc.Encode(in)
+	putJSONEncoder(e, err)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(buf.String(), "\n"), nil
+}
+
+// encodeJSONStreamWithBufAndEncoderPool はbufとjson.Encoderの両方をPoolから取る
+func encodeJSONStreamWithBufAndEncoderPool(in JsonData) (string, error) {
+	buf := encRespPool.Get().(*bytes.Buffer)
+	defer putUnlessPanic(encRespPool, buf)
+	buf.Reset()
+
+	e := getJSONEncoder(buf)
+	err := e.enc.Encode(in)
+	putJSONEncoder(e, err)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(buf.String(), "\n"), nil
+}
+
+// TestEncodeJSONAllocBreakdown はEncodeの各実装のアロケーション数を確かめる
+// 差を見ると、それぞれのPoolがどのアロケーションを減らしているかが分かる
+// EncodeJSONStreamとEncodeJSONの差はjson.NewEncoderではなく、bytes.Bufferがヒープに逃げる分とbufを伸ばす分の2つ
+// 今のGoではjson.NewEncoderはEncodeJSONStreamの中でヒープに確保されないので、Encoderだけ使いまわしても減らない
+// 残りの3つはJsonDataをinterfaceに入れる分、Encode内部の分、buf.String()で返り値を作る分
+func TestEncodeJSONAllocBreakdown(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	funcs := []struct {
+		name   string
+		f      func(JsonData) (string, error)
+		allocs float64
+	}{
+		{"EncodeJSON", EncodeJSON, 4},
+		{"EncodeJSONStream", EncodeJSONStream, 5},
+		{"EncodeJSONStreamWithPool(buf)", EncodeJSONStreamWithPool, 3},
+		{"EncodeJSONStreamWithEncoderPool(encoder)", encodeJSONStreamWithEncoderPool, 5},
+		{"EncodeJSONStreamWithBufAndEncoderPool(buf+encoder)", encodeJSONStreamWithBufAndEncoderPool, 3},
+	}
+	want, _ := EncodeJSON(JData)
+	for _, fn := range funcs {
+		if got, err := fn.f(JData); err != nil || got != want {
+			t.Fatalf("%s: got: %s, %v, want: %s", fn.name, got, err, want)
+		}
+		allocs := testing.AllocsPerRun(100, func() {
+			EncResult, _ = fn.f(JData)
+		})
+		if allocs != fn.allocs {
+			t.Errorf("%s: allocs: %v, want: %v", fn.name, allocs, fn.allocs)
+		}
+	}
+}
+
+func BenchmarkEncodeJSONStreamWithEncoderPool(b *testing.B) {
+	b.ReportAllocs()
+	var r string
+	for n := 0; n < b.N; n++ {
+		r, _ = encodeJSONStreamWithEncoderPool(JData)
+	}
+	EncResult = r
+}
+
+func BenchmarkEncodeJSONStreamWithBufAndEncoderPool(b *testing.B) {
+	b.ReportAllocs()
+	var r string
+	for n := 0; n < b.N; n++ {
+		r, _ = encodeJSONStreamWithBufAndEncoderPool(JData)
+	}
+	EncResult = r
+}
+
+// go test -run XX -bench 'EncodeJSON(Stream)?(WithPool|WithEncoderPool|WithBufAndEncoderPool)?$' .
+// BenchmarkEncodeJSONStreamWithEncoderPool       	 1637205	       882.2 ns/op	     272 B/op	       5 allocs/op
+// BenchmarkEncodeJSONStreamWithBufAndEncoderPool 	 1917210	       615.4 ns/op	     160 B/op	       3 allocs/op
+// BenchmarkEncodeJSON                            	 2002588	       584.7 ns/op	     224 B/op	       4 allocs/op
+// BenchmarkEncodeJSONStream                      	 1544316	       756.4 ns/op	     272 B/op	       5 allocs/op
+// BenchmarkEncodeJSONStreamWithPool              	 1683274	       620.9 ns/op	     160 B/op	       3 allocs/op
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"strings"
 	"sync"
@@ -33,15 +35,18 @@ func EncodeJSONStream(in JsonData) (string, error) {
 	return strings.TrimRight(buf.String(), "\n"), nil
 }
 
-var encRespPool = &sync.Pool{
-	New: func() interface{} {
-		return &bytes.Buffer{}
-	},
-}
+// Newが呼ばれた回数をMisses、割合をNewRateで見られるようにcountingPoolにしている
+var encRespPool = newCountingPool(func() interface{} {
+	return &bytes.Buffer{}
+})
 
 func EncodeJSONStreamWithPool(in JsonData) (string, error) {
+	return encodeJSONStreamWithPool(in)
+}
+
+func encodeJSONStreamWithPool(in interface{}) (string, error) {
 	buf := encRespPool.Get().(*bytes.Buffer)
-	defer encRespPool.Put(buf)
+	defer putUnlessPanic(encRespPool, buf)
 
 	buf.Reset() // 前のデータが残ったままなのでresetする
 	if err := json.NewEncoder(buf).Encode(in); err != nil {
@@ -50,6 +55,151 @@ func EncodeJSONStreamWithPool(in JsonData) (string, error) {
 	return strings.TrimRight(buf.String(), "\n"), nil
 }
 
+// putter はsync.PoolやcountingPoolのようにPutできるもの
+type putter interface {
+	Put(x interface{})
+}
+
+// putUnlessPanic はxをpoolに戻す。ただしpanicが起きていたら戻さずにpanicをそのまま伝える
+// panicした時のxは中途半端な状態かもしれないので、Poolに戻すと次に使う人が壊れたものを受け取ってしまう
+// recoverはdeferで直接呼ばれた関数の中でしか効かないので、必ず defer putUnlessPanic(pool, x) の形で使うこと
+func putUnlessPanic(pool putter, x interface{}) {
+	if r := recover(); r != nil {
+		panic(r)
+	}
+	pool.Put(x)
+}
+
+// jsonEncoderとjsonDecoderはgzipディレクトリのgzip_json_test.goにも同じものがある
+// ディレクトリごとに別のpackage mainなので共有できない。片方を変えたらもう片方も同じように変えること
+
+// jsonEncoder はjson.Encoderの書き込み先を差し替えられるようにしたもの
+// json.EncoderにはResetがないので、自分自身をio.Writerとして渡しておき、
+// 書き込みをwに転送することでEncoderごとPoolで使いまわす
+type jsonEncoder struct {
+	w   io.Writer
+	enc *json.Encoder
+}
+
+func (e *jsonEncoder) Write(p []byte) (int, error) {
+	return e.w.Write(p)
+}
+
+var jsonEncoderPool = &sync.Pool{
+	New: func() interface{} {
+		e := &jsonEncoder{}
+		e.enc = json.NewEncoder(e)
+		return e
+	},
+}
+
+func getJSONEncoder(w io.Writer) *jsonEncoder {
+	e := jsonEncoderPool.Get().(*jsonEncoder)
+	e.w = w
+	return e
+}
+
+// putJSONEncoder はEncoderをPoolに戻す
+// json.Encoderは一度書き込みに失敗するとそのエラーを保持し続けるので、
+// エラーが起きたEncoderはPoolに戻さずに捨てる
+func putJSONEncoder(e *jsonEncoder, err error) {
+	e.w = nil // 呼び出し元のWriterを参照し続けないようにする
+	if err != nil {
+		return
+	}
+	jsonEncoderPool.Put(e)
+}
+
+// jsonDecoder はjson.Decoderの読み込み元を差し替えられるようにしたもの
+// json.DecoderにはResetがないので、自分自身をio.Readerとして渡しておき、
+// 読み込みをrから行うことでDecoderごとPoolで使いまわす
+type jsonDecoder struct {
+	r     io.Reader
+	dec   *json.Decoder
+	start int64      // 今回の入力の先頭のInputOffset
+	pool  *sync.Pool // 取り出したPool
+
+	// moreInputで先読みした1バイト。次のReadで先に返す
+	peekBuf [1]byte
+	peeked  []byte
+}
+
+func (d *jsonDecoder) Read(p []byte) (int, error) {
+	if len(d.peeked) > 0 {
+		n := copy(p, d.peeked)
+		d.peeked = d.peeked[n:]
+		return n, nil
+	}
+	return d.r.Read(p)
+}
+
+// InputOffset は今回の入力の先頭からのオフセットを返す
+func (d *jsonDecoder) InputOffset() int64 {
+	return d.dec.InputOffset() - d.start
+}
+
+// newJSONDecoderPool はsetupで設定したjson.DecoderのPoolを作る
+// DisallowUnknownFieldsなどの設定は後から解除できないので、設定ごとにPoolを分ける
+func newJSONDecoderPool(setup func(dec *json.Decoder)) *sync.Pool {
+	pool := &sync.Pool{}
+	pool.New = func() interface{} {
+		d := &jsonDecoder{pool: pool}
+		d.dec = json.NewDecoder(d)
+		if setup != nil {
+			setup(d.dec)
+		}
+		return d
+	}
+	return pool
+}
+
+var (
+	jsonDecoderPool       = newJSONDecoderPool(nil)
+	strictJSONDecoderPool = newJSONDecoderPool(func(dec *json.Decoder) {
+		dec.DisallowUnknownFields()
+	})
+)
+
+func getJSONDecoder(pool *sync.Pool, r io.Reader) *jsonDecoder {
+	d := pool.Get().(*jsonDecoder)
+	d.r = r
+	d.peeked = nil
+	return d
+}
+
+// putJSONDecoder はDecoderをPoolに戻す
+// json.Decoderはエラー(Decodeで読み切った時のio.EOFも含む)を保持し続けるうえ、
+// 読み込んだ後の余りのデータをバッファに持っているので、
+// エラーが起きたときや空白以外の余りがあるときはPoolに戻さずに捨てる
+func putJSONDecoder(d *jsonDecoder, err error) {
+	d.r = nil // 呼び出し元のReaderを参照し続けないようにする
+	if err != nil || len(d.peeked) > 0 {
+		return
+	}
+	rest, ok := d.dec.Buffered().(*bytes.Reader)
+	if !ok {
+		return
+	}
+	// 余りの空白は次のDecodeで読み飛ばされるので、その分だけ次の入力の先頭がずれる
+	d.start = d.dec.InputOffset() + int64(rest.Len())
+	for rest.Len() > 0 {
+		c, _ := rest.ReadByte()
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			return
+		}
+	}
+	d.pool.Put(d)
+}
+
+// decoderBroken はDecodeのエラーでjson.Decoderが使えなくなったかを返す
+// 構文エラーや読み込みのエラーはDecoderに保持されるが、
+// unknown fieldなどのUnmarshalのエラーは値を読み切った後に起きるのでDecoderはそのまま使える
+// 読み込み自体がエラーにならない(stringなどメモリ上の)入力に対してだけ使うこと
+func decoderBroken(err error) bool {
+	var se *json.SyntaxError
+	return errors.As(err, &se) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
 func DecodeJSON(in string) (JsonData, error) {
 	var res JsonData
 	if err := json.Unmarshal([]byte(in), &res); err != nil {
@@ -66,14 +216,13 @@ func DecodeJSONStream(in io.Reader) (JsonData, error) {
 	return res, nil
 }
 
-var decRespPool = &sync.Pool{
-	New: func() interface{} {
-		return &JsonData{}
-	},
-}
+// decRespPool はGetでJsonDataをResetするので、前にデコードした値は残らない
+var decRespPool = NewResettingPool(func() *JsonData {
+	return &JsonData{}
+})
 
 func DecodeJSONWithPool(in string) (JsonData, error) {
-	res := decRespPool.Get().(*JsonData)
+	res := decRespPool.Get()
 	defer decRespPool.Put(res)
 
 	if err := json.Unmarshal([]byte(in), &res); err != nil {
@@ -82,11 +231,25 @@ func DecodeJSONWithPool(in string) (JsonData, error) {
 	return *res, nil
 }
 
+var bufioReaderPool = &sync.Pool{
+	New: func() interface{} {
+		return bufio.NewReader(nil)
+	},
+}
+
 func DecodeJSONStreamWithPool(in io.Reader) (JsonData, error) {
-	res := decRespPool.Get().(*JsonData)
+	res := decRespPool.Get()
 	defer decRespPool.Put(res)
 
-	if err := json.NewDecoder(in).Decode(&res); err != nil {
+	// bufio.Readerを通して、inからはまとめて読み込むようにする
+	br := bufioReaderPool.Get().(*bufio.Reader)
+	br.Reset(in)
+	defer func() {
+		br.Reset(nil) // Poolに戻した後にinを参照し続けないようにする
+		bufioReaderPool.Put(br)
+	}()
+
+	if err := json.NewDecoder(br).Decode(&res); err != nil {
 		return JsonData{}, err
 	}
 	return *res, nil
@@ -222,6 +385,48 @@ func BenchmarkEncodeJSONStreamWithPool(b *testing.B) {
 	EncResult = r
 }
 
+// 上のBenchmarkは1つのgoroutineで実行しているが、
+// sync.Poolが効くのは複数のgoroutineで同時に使ってGCの負荷が高いときなので、
+// b.RunParallelで並行に実行した場合も比較する
+func BenchmarkEncodeJSONParallel(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var r string
+		for pb.Next() {
+			r, _ = EncodeJSON(JData)
+		}
+		if r == "" {
+			b.Error("empty result")
+		}
+	})
+}
+
+func BenchmarkEncodeJSONStreamParallel(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var r string
+		for pb.Next() {
+			r, _ = EncodeJSONStream(JData)
+		}
+		if r == "" {
+			b.Error("empty result")
+		}
+	})
+}
+
+func BenchmarkEncodeJSONStreamWithPoolParallel(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var r string
+		for pb.Next() {
+			r, _ = EncodeJSONStreamWithPool(JData)
+		}
+		if r == "" {
+			b.Error("empty result")
+		}
+	})
+}
+
 func BenchmarkDecodeJSON(b *testing.B) {
 	b.ReportAllocs()
 	var r JsonData
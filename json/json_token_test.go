@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// ForEachJSONToken はrのJSONをTokenごとにfnに渡す
+// 全体をUnmarshalせずに、巨大なJSONから一部の値だけを取り出したいときに使う
+// fnがエラーを返した時点で読むのをやめて、そのエラーを返す
+// 途中でやめたDecoderはTokenの状態が中途半端なのでPoolには戻さない
+func ForEachJSONToken(r io.Reader, fn func(json.Token) error) error {
+	d := getJSONDecoder(jsonDecoderPool, r)
+	for {
+		tok, err := d.dec.Token()
+		if err == io.EOF {
+			// 最後まで読んだDecoderは再利用できる
+			putJSONDecoder(d, nil)
+			return nil
+		}
+		if err != nil {
+			putJSONDecoder(d, err)
+			return err
+		}
+		if err := fn(tok); err != nil {
+			putJSONDecoder(d, err)
+			return err
+		}
+	}
+}
+
+var errFound = errors.New("found")
+
+func TestForEachJSONToken(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString(`{"id":1,"name":"Jack","items":[`)
+	for i := 0; i < 10000; i++ {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, `"item%d"`, i)
+	}
+	sb.WriteString(`]}`)
+	large := sb.String()
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		t.Run("find_name", func(t *testing.T) {
+			var name string
+			var prev json.Token
+			count := 0
+			err := ForEachJSONToken(strings.NewReader(large), func(tok json.Token) error {
+				count++
+				if prev == "name" {
+					name, _ = tok.(string)
+					return errFound
+				}
+				prev = tok
+				return nil
+			})
+			if !errors.Is(err, errFound) {
+				t.Fatalf("got: %v, want: %v", err, errFound)
+			}
+			if name != "Jack" {
+				t.Errorf("got: %s, want: %s", name, "Jack")
+			}
+			// itemsを読む前にやめている
+			if count != 5 {
+				t.Errorf("count: %d, want: %d", count, 5)
+			}
+		})
+
+		t.Run("all_tokens", func(t *testing.T) {
+			var got []json.Token
+			err := ForEachJSONToken(strings.NewReader(`{"id":1,"items":["a"]}`), func(tok json.Token) error {
+				got = append(got, tok)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := fmt.Sprint([]json.Token{json.Delim('{'), "id", float64(1), "items", json.Delim('['), "a", json.Delim(']'), json.Delim('}')})
+			if fmt.Sprint(got) != want {
+				t.Errorf("got: %v, want: %v", got, want)
+			}
+		})
+
+		t.Run("syntax_error", func(t *testing.T) {
+			err := ForEachJSONToken(strings.NewReader(`{"id":1,}`), func(tok json.Token) error {
+				return nil
+			})
+			if err == nil {
+				t.Error("want error")
+			}
+		})
+	}
+}
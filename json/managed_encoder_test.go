@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// ManagedEncoderStats はManagedEncoderがこれまでに見たbufの様子
+type ManagedEncoderStats struct {
+	Peak    int64 // これまでで一番大きかったbufの容量
+	Dropped int64 // 容量がMaxCapを超えたのでPoolに戻さずに捨てたbufの数
+}
+
+// ManagedEncoder はJSONのEncode用のbufをPoolで使いまわす
+// 一度だけ来た巨大なJSONのbufをPoolに戻すと、そのメモリをずっと持ち続けてしまうので、
+// 容量がMaxCapを超えたbufはPoolに戻さずに捨てる
+// Statsで一番大きかったbufの容量と捨てた数が分かるので、MaxCapを決める目安にする
+type ManagedEncoder struct {
+	MaxCap int
+
+	pool    sync.Pool
+	news    atomic.Int64 // Newが呼ばれた回数
+	peak    atomic.Int64
+	dropped atomic.Int64
+}
+
+func NewManagedEncoder(maxCap int) *ManagedEncoder {
+	m := &ManagedEncoder{MaxCap: maxCap}
+	m.pool.New = func() interface{} {
+		m.news.Add(1)
+		return &bytes.Buffer{}
+	}
+	return m
+}
+
+// Encode はvをJSONにする。返り値はPoolのbufからコピーしたもの
+func (m *ManagedEncoder) Encode(v interface{}) ([]byte, error) {
+	buf := m.pool.Get().(*bytes.Buffer)
+	defer m.put(buf)
+	buf.Reset()
+
+	e := getJSONEncoder(buf)
+	err := e.enc.Encode(v)
+	putJSONEncoder(e, err)
+	if err != nil {
+		return nil, err
+	}
+
+	// Encodeが最後に付ける改行は除く
+	res := make([]byte, buf.Len()-1)
+	copy(res, buf.Bytes())
+	return res, nil
+}
+
+func (m *ManagedEncoder) put(buf *bytes.Buffer) {
+	c := int64(buf.Cap())
+	for {
+		peak := m.peak.Load()
+		if c <= peak || m.peak.CompareAndSwap(peak, c) {
+			break
+		}
+	}
+	if buf.Cap() > m.MaxCap {
+		m.dropped.Add(1)
+		return
+	}
+	m.pool.Put(buf)
+}
+
+func (m *ManagedEncoder) Stats() ManagedEncoderStats {
+	return ManagedEncoderStats{
+		Peak:    m.peak.Load(),
+		Dropped: m.dropped.Load(),
+	}
+}
+
+func TestManagedEncoder(t *testing.T) {
+	m := NewManagedEncoder(1024)
+	small := JsonData{ID: 1, Name: "Jack", Items: []string{"knife", "shield", "herbs"}}
+	large := JsonData{ID: 2, Name: strings.Repeat("x", 4096)}
+
+	wantDropped := int64(0)
+	for i := 0; i < 3; i++ {
+		for _, v := range []JsonData{small, large, small} {
+			got, err := m.Encode(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := EncodeJSON(v)
+			if string(got) != want {
+				t.Errorf("got: %s, want: %s", got, want)
+			}
+			if v.ID == large.ID {
+				wantDropped++
+			}
+			if got := m.Stats().Dropped; got != wantDropped {
+				t.Errorf("Dropped: got %d, want %d", got, wantDropped)
+			}
+		}
+	}
+	if peak := m.Stats().Peak; peak < 4096 {
+		t.Errorf("Peak: got %d, want >= 4096", peak)
+	}
+
+	if testing.Short() {
+		return
+	}
+	// 小さいbufはPoolに戻って使いまわされるので、小さいものだけをEncodeしている間はNewが呼ばれない
+	before := m.news.Load()
+	for i := 0; i < 10; i++ {
+		if _, err := m.Encode(small); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if news := m.news.Load(); news != before {
+		t.Errorf("New was called %d times for small buffers, want 0", news-before)
+	}
+	if got := m.Stats().Dropped; got != wantDropped {
+		t.Errorf("Dropped: got %d, want %d", got, wantDropped)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// Marshaler は自分のJSONをbufに書き込む
+// easyjsonなどで生成した速いエンコーダを持つ型も、これを実装すればEncodeWithPoolのPoolのbufを使える
+type Marshaler interface {
+	MarshalTo(buf *bytes.Buffer) error
+}
+
+// EncodeWithPool はPoolのbufにmを書き込ませて、結果をコピーして返す
+func EncodeWithPool(m Marshaler) ([]byte, error) {
+	buf := encRespPool.Get().(*bytes.Buffer)
+	defer putUnlessPanic(encRespPool, buf)
+
+	buf.Reset()
+	if err := m.MarshalTo(buf); err != nil {
+		return nil, err
+	}
+	res := make([]byte, buf.Len())
+	copy(res, buf.Bytes())
+	return res, nil
+}
+
+// MarshalTo はdをJSONにしてbufの後ろに書き込む
+// 標準のjson.Encoderを使うが、最後の改行は書き込まない
+func (d JsonData) MarshalTo(buf *bytes.Buffer) error {
+	e := getJSONEncoder(buf)
+	err := e.enc.Encode(d)
+	putJSONEncoder(e, err)
+	if err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+// idMarshaler は標準のエンコーダを使わずに手で書き込むMarshaler
+type idMarshaler struct {
+	id  int
+	err error
+}
+
+func (m idMarshaler) MarshalTo(buf *bytes.Buffer) error {
+	if m.err != nil {
+		buf.WriteString(`{"id":`) // 途中まで書いてから失敗する
+		return m.err
+	}
+	buf.WriteString(`{"id":`)
+	buf.WriteString(strconv.Itoa(m.id))
+	buf.WriteByte('}')
+	return nil
+}
+
+func TestEncodeWithPool(t *testing.T) {
+	errMarshal := errors.New("marshal error")
+
+	tests := map[string]struct {
+		m       Marshaler
+		want    string
+		wantErr error
+	}{
+		"JsonData":     {JData, `{"id":1,"name":"Jack","items":["knife","shield","herbs"]}`, nil},
+		"idMarshaler":  {idMarshaler{id: 42}, `{"id":42}`, nil},
+		"marshalError": {idMarshaler{err: errMarshal}, "", errMarshal},
+	}
+
+	for i := 0; i < 2; i++ {
+		for name, tt := range tests {
+			t.Run(name, func(t *testing.T) {
+				got, err := EncodeWithPool(tt.m)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error: %v, want: %v", err, tt.wantErr)
+				}
+				if string(got) != tt.want {
+					t.Errorf("got: %s, want: %s", got, tt.want)
+				}
+			})
+		}
+	}
+
+	// MarshalToはbufの後ろに追加する
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	if err := JData.MarshalTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString("]")
+	if want := `[{"id":1,"name":"Jack","items":["knife","shield","herbs"]}]`; buf.String() != want {
+		t.Errorf("got: %s, want: %s", buf.String(), want)
+	}
+}
+
+func BenchmarkEncodeWithPool(b *testing.B) {
+	b.ReportAllocs()
+	var r []byte
+	for n := 0; n < b.N; n++ {
+		r, _ = EncodeWithPool(JData)
+	}
+	EncBytesResult = r
+}
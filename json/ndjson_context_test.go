@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// moreInput はまだデコードしていない入力が残っているかを返す
+// json.DecoderのMoreやDecodeは入力の終わりに達するとio.EOFを保持して使えなくなるので、
+// Decoderのバッファが空白だけのときは、rから1バイトずつ先読みして終わりかどうかを確認する
+// 空白以外を先読みしたら、そのバイトは次のReadでDecoderに渡す
+func (d *jsonDecoder) moreInput() (bool, error) {
+	if rest, ok := d.dec.Buffered().(*bytes.Reader); ok {
+		for rest.Len() > 0 {
+			if c, _ := rest.ReadByte(); c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+				return true, nil
+			}
+		}
+	}
+	for {
+		n, err := d.r.Read(d.peekBuf[:])
+		if n > 0 {
+			if c := d.peekBuf[0]; c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+				// 空白はDecoderに渡さずに読み捨てるので、その分InputOffsetの基準をずらしておく
+				d.start--
+				continue
+			}
+			d.peeked = d.peekBuf[:n]
+			return true, nil
+		}
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// DecodeNDJSONContext は改行区切りのJSON(NDJSON)をrから1行ずつJsonDataにデコードしてfnに渡す
+// レコードを読む前に毎回ctxを確認し、キャンセルされていたらctx.Err()を返す
+// ただしrのReadがブロックしている間はキャンセルに気付けない
+// fnがエラーを返したらそこで読むのをやめて、そのエラーを返す
+func DecodeNDJSONContext(ctx context.Context, r io.Reader, fn func(JsonData) error) error {
+	d := getJSONDecoder(jsonDecoderPool, r)
+	for {
+		if err := ctx.Err(); err != nil {
+			putJSONDecoder(d, err)
+			return err
+		}
+		more, err := d.moreInput()
+		if err != nil {
+			putJSONDecoder(d, err)
+			return err
+		}
+		if !more {
+			// 最後まで読んでもDecoderはio.EOFを保持していないので、Poolに戻せる
+			putJSONDecoder(d, nil)
+			return nil
+		}
+		var v JsonData
+		if err := d.dec.Decode(&v); err != nil {
+			putJSONDecoder(d, err)
+			return err
+		}
+		if err := fn(v); err != nil {
+			putJSONDecoder(d, err)
+			return err
+		}
+	}
+}
+
+var errRead = errors.New("read error")
+
+func TestDecodeNDJSONContext(t *testing.T) {
+	var lines []string
+	var want []JsonData
+	for i := 0; i < 5; i++ {
+		lines = append(lines, fmt.Sprintf(`{"id":%d,"name":"user%d","items":["knife"]}`, i, i))
+		want = append(want, JsonData{ID: i, Name: fmt.Sprintf("user%d", i), Items: []string{"knife"}})
+	}
+	in := strings.Join(lines, "\n") + "\n"
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		t.Run("all", func(t *testing.T) {
+			var got []JsonData
+			err := DecodeNDJSONContext(context.Background(), strings.NewReader(in), func(v JsonData) error {
+				got = append(got, v)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("got: %v,want: %v, diff: %s", got, want, diff)
+			}
+		})
+		t.Run("cancel_after_two", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var got []JsonData
+			err := DecodeNDJSONContext(ctx, strings.NewReader(in), func(v JsonData) error {
+				got = append(got, v)
+				if len(got) == 2 {
+					cancel()
+				}
+				return nil
+			})
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("got: %v, want: %v", err, context.Canceled)
+			}
+			if diff := cmp.Diff(got, want[:2]); diff != "" {
+				t.Errorf("got: %v,want: %v, diff: %s", got, want[:2], diff)
+			}
+		})
+		t.Run("syntax_error", func(t *testing.T) {
+			err := DecodeNDJSONContext(context.Background(), strings.NewReader(lines[0]+"\n]\n"), func(JsonData) error { return nil })
+			var se *json.SyntaxError
+			if !errors.As(err, &se) {
+				t.Errorf("got: %v, want syntax error", err)
+			}
+		})
+		t.Run("read_error", func(t *testing.T) {
+			r := io.MultiReader(strings.NewReader(lines[0]+"\n"), iotest.ErrReader(errRead))
+			var got []JsonData
+			err := DecodeNDJSONContext(context.Background(), r, func(v JsonData) error {
+				got = append(got, v)
+				return nil
+			})
+			if !errors.Is(err, errRead) {
+				t.Errorf("got: %v, want: %v", err, errRead)
+			}
+			if len(got) != 1 {
+				t.Errorf("got %d records, want: 1", len(got))
+			}
+		})
+		t.Run("empty", func(t *testing.T) {
+			err := DecodeNDJSONContext(context.Background(), strings.NewReader("\n"), func(JsonData) error {
+				t.Error("fn called for empty input")
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+type panicMarshaler struct{}
+
+func (panicMarshaler) MarshalJSON() ([]byte, error) {
+	panic("MarshalJSON panic")
+}
+
+func TestEncodeJSONStreamWithPoolPanic(t *testing.T) {
+	// Encode中にpanicしたbufはPoolに戻らないことを確認するため、目印を付けたbufを入れておく
+	// 先にGetしてPoolのprivateを空にしておかないと、次のGetで別のbufが返ってくる
+	encRespPool.Get()
+	marked := &bytes.Buffer{}
+	marked.WriteString("marked")
+	encRespPool.Put(marked)
+
+	func() {
+		defer func() {
+			if r := recover(); r != "MarshalJSON panic" {
+				t.Errorf("recovered: %v, want: %v", r, "MarshalJSON panic")
+			}
+		}()
+		encodeJSONStreamWithPool(panicMarshaler{})
+		t.Error("want panic")
+	}()
+
+	if got := encRespPool.Get().(*bytes.Buffer); got == marked {
+		t.Error("buffer was returned to the pool after panic")
+	}
+
+	// panicの後も正しくEncodeできる
+	want := `{"id":1,"name":"Jack","items":["knife","shield","herbs"]}`
+	got, err := EncodeJSONStreamWithPool(JData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+}
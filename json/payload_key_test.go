@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"sync"
+	"testing"
+)
+
+// payloadHasher はPayloadKeyで使うsha256のhashと結果を入れる配列
+type payloadHasher struct {
+	h   hash.Hash
+	sum [sha256.Size]byte
+	hex [sha256.Size * 2]byte
+}
+
+var payloadHasherPool = &sync.Pool{
+	New: func() interface{} {
+		return &payloadHasher{h: sha256.New()}
+	},
+}
+
+// PayloadKey はinをJSONにしたもののsha256をhexにした文字列を返す
+// キャッシュのキーなどに使う。JSONのフィールドの順番は構造体で決まっているので、同じ内容なら同じキーになる
+// JSONはPoolのEncoderでhashに直接書き込むので、JSONの[]byteを作らない
+func PayloadKey(in JsonData) (string, error) {
+	p := payloadHasherPool.Get().(*payloadHasher)
+	defer payloadHasherPool.Put(p)
+	p.h.Reset() // 前の入力のhashの状態が残っているのでResetする
+
+	e := getJSONEncoder(p.h)
+	err := e.enc.Encode(in)
+	putJSONEncoder(e, err)
+	if err != nil {
+		return "", err
+	}
+
+	sum := p.h.Sum(p.sum[:0])
+	hex.Encode(p.hex[:], sum)
+	return string(p.hex[:]), nil
+}
+
+func TestPayloadKey(t *testing.T) {
+	a := JsonData{ID: 1, Name: "Jack", Items: []string{"knife", "shield", "herbs"}}
+	// aと同じ内容だが別のSliceを持つ
+	b := JsonData{ID: 1, Name: "Jack", Items: append([]string{}, a.Items...)}
+	c := JsonData{ID: 1, Name: "Jack", Items: []string{"knife", "shield"}}
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	var keys []string
+	for i := 0; i < 2; i++ {
+		keyA, err := PayloadKey(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyB, err := PayloadKey(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyC, err := PayloadKey(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keyA != keyB {
+			t.Errorf("equal payloads got different keys: %s, %s", keyA, keyB)
+		}
+		if keyA == keyC {
+			t.Errorf("different payloads got the same key: %s", keyA)
+		}
+		keys = append(keys, keyA)
+	}
+	if keys[0] != keys[1] {
+		t.Errorf("key changed between calls: %s, %s", keys[0], keys[1])
+	}
+
+	// EncodeJSONStreamの出力(最後の改行付き)のsha256と同じ
+	encoded, _ := EncodeJSONStream(a)
+	want := sha256.Sum256([]byte(encoded + "\n"))
+	if keys[0] != hex.EncodeToString(want[:]) {
+		t.Errorf("got: %s, want: %x", keys[0], want)
+	}
+}
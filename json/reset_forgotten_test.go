@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// encodeJSONStreamWithPoolNoReset はEncodeJSONStreamWithPoolからbuf.Reset()を抜いた間違った実装
+// Resetを忘れるとどうなるかをテストで確認するためだけのもの。使ってはいけない
+// 正しい実装のencRespPoolを汚さないように、別のPoolを使う
+var noResetPool = &sync.Pool{
+	New: func() interface{} {
+		return &bytes.Buffer{}
+	},
+}
+
+func encodeJSONStreamWithPoolNoReset(in JsonData) (string, error) {
+	buf := noResetPool.Get().(*bytes.Buffer)
+	defer noResetPool.Put(buf)
+
+	if err := json.NewEncoder(buf).Encode(in); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(buf.String(), "\n"), nil
+}
+
+func TestEncodeJSONStreamWithPoolResetForgotten(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	first := JsonData{ID: 1, Name: "Jack", Items: []string{"knife"}}
+	second := JsonData{ID: 2, Name: "Emma", Items: []string{"bow"}}
+	wantFirst, _ := EncodeJSON(first)
+	wantSecond, _ := EncodeJSON(second)
+
+	// Resetを忘れると、2回目の結果に1回目にPoolのbufへ書いたJSONが前に付いたままになる
+	noResetPool.Get() // per-Pのprivateを空にしておく
+	if got, _ := encodeJSONStreamWithPoolNoReset(first); got != wantFirst {
+		t.Fatalf("first call: got: %s, want: %s", got, wantFirst)
+	}
+	got, _ := encodeJSONStreamWithPoolNoReset(second)
+	if want := wantFirst + "\n" + wantSecond; got != want {
+		t.Errorf("without Reset: got: %s, want concatenated output: %s", got, want)
+	}
+
+	// 正しい実装はGetした後にResetしているので、毎回その入力のJSONだけになる
+	for i := 0; i < 2; i++ {
+		for _, tc := range []struct {
+			in   JsonData
+			want string
+		}{{first, wantFirst}, {second, wantSecond}} {
+			if got, _ := EncodeJSONStreamWithPool(tc.in); got != tc.want {
+				t.Errorf("with Reset: got: %s, want: %s", got, tc.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// Poolable はResettingPoolに入れられる値
+// Resetで前に使った時の状態を消して、新しく作った時と同じように使える状態に戻す
+type Poolable interface {
+	Reset()
+}
+
+// ResettingPool はGetした値のResetを自動で呼ぶsync.Pool
+// 呼び出し側でGetの後にResetを書き忘れて、前の値が残るミスを防ぐ
+type ResettingPool[T Poolable] struct {
+	pool sync.Pool
+}
+
+func NewResettingPool[T Poolable](newFunc func() T) *ResettingPool[T] {
+	p := &ResettingPool[T]{}
+	p.pool.New = func() interface{} {
+		return newFunc()
+	}
+	return p
+}
+
+// Get はPoolから取った値をResetしてから返す
+func (p *ResettingPool[T]) Get() T {
+	x := p.pool.Get().(T)
+	x.Reset()
+	return x
+}
+
+func (p *ResettingPool[T]) Put(x T) {
+	p.pool.Put(x)
+}
+
+// Reset はJsonDataをゼロ値にする
+// Itemsの配列は使い回さない。DecodeJSONWithPoolのように*resをそのまま返すと、
+// 呼び出し元がその配列を持ち続けるので、次のデコードで書き換えてしまわないようにする
+func (d *JsonData) Reset() {
+	*d = JsonData{}
+}
+
+// resetCounter はResetが呼ばれた回数を数える
+type resetCounter struct {
+	resets int
+	val    string
+}
+
+func (c *resetCounter) Reset() {
+	c.resets++
+	c.val = ""
+}
+
+func TestResettingPool(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+
+	t.Run("Reset_is_called_on_Get", func(t *testing.T) {
+		p := NewResettingPool(func() *resetCounter { return &resetCounter{} })
+		c := p.Get()
+		if c.resets != 1 {
+			t.Errorf("resets: %d, want: %d", c.resets, 1)
+		}
+		c.val = "dirty"
+		p.Put(c)
+
+		got := p.Get()
+		if got != c {
+			t.Fatal("want the same value back from the pool")
+		}
+		if got.resets != 2 || got.val != "" {
+			t.Errorf("got resets %d, val %q, want 2, empty", got.resets, got.val)
+		}
+	})
+
+	t.Run("JsonData", func(t *testing.T) {
+		p := NewResettingPool(func() *JsonData { return &JsonData{} })
+		d := p.Get()
+		*d = JsonData{ID: 1, Name: "Jack", Items: []string{"knife", "shield"}}
+		held := d.Items
+		p.Put(d)
+
+		got := p.Get()
+		if got != d {
+			t.Fatal("want the same value back from the pool")
+		}
+		// Itemsはnilに戻り、前の配列を指さない
+		if !reflect.DeepEqual(*got, JsonData{}) {
+			t.Errorf("state leaked across Get: %+v", *got)
+		}
+		got.Items = append(got.Items, "sword")
+		if held[0] != "knife" {
+			t.Errorf("Items held by the previous user was overwritten: %q", held)
+		}
+	})
+}
+
+func TestDecodeJSONWithPoolNoLeftover(t *testing.T) {
+	// decRespPoolはGetでResetするので、入力にないフィールドに前の値が残らない
+	for i := 0; i < 2; i++ {
+		first, err := DecodeJSONWithPool(SData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := DecodeJSONWithPool(`{"id":2}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, JsonData{ID: 2}) {
+			t.Errorf("got: %+v, want: %+v", got, JsonData{ID: 2})
+		}
+		if !reflect.DeepEqual(first, JData) {
+			t.Errorf("first result was overwritten: %+v", first)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var errDirtyJsonData = errors.New("JsonData was modified after it was put back to the pool")
+
+// verifiedJSONDataPool はJsonDataのPoolの使い方を確かめるためのラッパー
+// poolDebugのときは、Putで中身を空にして(Itemsの配列は次に使うために残す)、次のGetでまだ空のままかを確認する
+// 空でなければ、Putした後もどこかでそのJsonDataかItemsの配列を持ち続けて書き換えている
+// 本番ではGetもPutも何もしないので、Getした側で前の値を消してから使うこと
+// 空にしないままPutする他の関数と同じPoolを使うと確認が誤って失敗するので、このラッパー専用のPoolを渡すこと
+type verifiedJSONDataPool struct {
+	pool *sync.Pool
+}
+
+var verifiedDecRespPool = verifiedJSONDataPool{pool: newJSONDataPool()}
+
+func newJSONDataPool() *sync.Pool {
+	return &sync.Pool{
+		New: func() interface{} {
+			return &JsonData{}
+		},
+	}
+}
+
+func (p verifiedJSONDataPool) Get() *JsonData {
+	d := p.pool.Get().(*JsonData)
+	if poolDebug && !d.zeroed() {
+		panic(errDirtyJsonData)
+	}
+	return d
+}
+
+func (p verifiedJSONDataPool) Put(d *JsonData) {
+	if poolDebug {
+		clear(d.Items[:cap(d.Items)])
+		*d = JsonData{Items: d.Items[:0]}
+	}
+	p.pool.Put(d)
+}
+
+// enableVerifiedDecRespPool はテストの間だけpoolDebugにして、verifiedDecRespPoolを新しいPoolにする
+// poolDebugでない間にPutしたJsonDataは空にしていないので、そのままGetの確認を有効にすると誤って失敗する
+func enableVerifiedDecRespPool(t *testing.T) {
+	d, pool := poolDebug, verifiedDecRespPool.pool
+	t.Cleanup(func() {
+		poolDebug, verifiedDecRespPool.pool = d, pool
+	})
+	poolDebug, verifiedDecRespPool.pool = true, newJSONDataPool()
+}
+
+// zeroed はItemsの配列も含めて空かどうかを返す
+func (d *JsonData) zeroed() bool {
+	if d.ID != 0 || d.Name != "" || len(d.Items) != 0 {
+		return false
+	}
+	for _, s := range d.Items[:cap(d.Items)] {
+		if s != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// DecodeJSONInto はPoolのJsonDataにinをデコードして、outにコピーする
+// PoolのJsonDataは前の値を消してから使い、Itemsはoutの配列にコピーするので、
+// outのItemsとPoolのJsonDataが配列を共有しない
+// outのItemsの容量が足りていればその配列を使い回すので、1つのoutでループしてもItemsの配列を作り直さない
+func DecodeJSONInto(in string, out *JsonData) error {
+	res := verifiedDecRespPool.Get()
+	defer verifiedDecRespPool.Put(res)
+
+	*res = JsonData{Items: res.Items[:0]}
+	if err := json.Unmarshal([]byte(in), res); err != nil {
+		return err
+	}
+	res.copyInto(out)
+	return nil
+}
+
+// decodeJSONIntoShared はDecodeJSONIntoを直す前の実装
+// PoolのJsonDataをそのままoutにコピーするので、outのItemsがPoolのJsonDataと配列を共有している
+func decodeJSONIntoShared(in string, out *JsonData) error {
+	res := verifiedDecRespPool.Get()
+	defer verifiedDecRespPool.Put(res)
+
+	*res = JsonData{Items: res.Items[:0]}
+	if err := json.Unmarshal([]byte(in), res); err != nil {
+		return err
+	}
+	*out = *res
+	return nil
+}
+
+func TestDecodeJSONInto(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	enableVerifiedDecRespPool(t)
+
+	// Poolを正しく使わないと前にPutした値をGetで取ってきてしまうミスがあり得る
+	// そのため、２回実行しても同じ結果であることを確認している
+	for i := 0; i < 2; i++ {
+		var got JsonData
+		if err := DecodeJSONInto(SData, &got); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(got, JData); diff != "" {
+			t.Errorf("got: %v,want: %v, diff: %s", got, JData, diff)
+		}
+		// 返り値を書き換えてもPoolのJsonDataは空のまま
+		got.Items[0] = "mutated"
+		verifiedDecRespPool.Put(verifiedDecRespPool.Get())
+	}
+}
+
+func TestDecodeJSONIntoSharedIsDirty(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	enableVerifiedDecRespPool(t)
+
+	var got JsonData
+	if err := decodeJSONIntoShared(SData, &got); err != nil {
+		t.Fatal(err)
+	}
+	// outのItemsはPoolのJsonDataと配列を共有しているので、Putで空にした時にoutのItemsも消えてしまう
+	if want := []string{"", "", ""}; !cmp.Equal(got.Items, want) {
+		t.Errorf("got: %q, want: %q", got.Items, want)
+	}
+	// 逆に呼び出し元がoutのItemsを書き換えると、Poolの中身が変わる
+	got.Items[0] = "mutated"
+
+	defer func() {
+		if r := recover(); r != errDirtyJsonData {
+			t.Errorf("recovered: %v, want: %v", r, errDirtyJsonData)
+		}
+	}()
+	verifiedDecRespPool.Get()
+	t.Error("want panic")
+}
+
+func TestVerifiedJSONDataPoolWithoutPoolDebug(t *testing.T) {
+	defer func(d bool) { poolDebug = d }(poolDebug)
+	poolDebug = false
+
+	// 本番ではPutで空にしないし、Getで確認もしない
+	p := verifiedJSONDataPool{pool: newJSONDataPool()}
+	d := &JsonData{ID: 1, Name: "Jack", Items: []string{"knife"}}
+	p.Put(d)
+	if d.ID != 1 || d.Name != "Jack" || d.Items[0] != "knife" {
+		t.Errorf("Put modified JsonData without poolDebug: %+v", *d)
+	}
+	p.Get()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// Newを設定しないPool。Getで何も取れなかった時はnilが返るので、呼び出し側でnに合わせたcapで作る
+var capPool = &sync.Pool{}
+
+// ReplicateStrNTimesWithPoolCap はReplicateStrNTimesWithPoolと同じ結果を返すが、
+// 最初からcap nのSliceを用意するので、大きいnでもappendの途中で配列を作り直さない
+// Poolから取ったSliceのcapがnより小さいときだけ、cap nで作り直す
+func ReplicateStrNTimesWithPoolCap(s string, n int) []string {
+	return replicateStrNTimesWithCapPool(capPool, s, n)
+}
+
+func replicateStrNTimesWithCapPool(pool *sync.Pool, s string, n int) []string {
+	ss, _ := pool.Get().(*[]string)
+	if ss == nil {
+		l := make([]string, 0, n)
+		ss = &l
+	} else if cap(*ss) < n {
+		*ss = make([]string, 0, n)
+	}
+	defer pool.Put(ss)
+	(*ss) = (*ss)[:0]
+	for i := 0; i < n; i++ {
+		(*ss) = append((*ss), s)
+	}
+	return *ss
+}
+
+func TestReplicateStrNTimesWithPoolCap(t *testing.T) {
+	for _, n := range []int{5, 10, 1, 0, 1000, 5} {
+		t.Run(fmt.Sprintf("n=%d", n), func(t *testing.T) {
+			got := ReplicateStrNTimesWithPoolCap("12345", n)
+			want := ReplicateStrNTimes("12345", n)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got: %s, want: %s", got, want)
+			}
+		})
+	}
+
+	withCap := func(s string) []string { return ReplicateStrNTimesWithPoolCap(s, 10) }
+	want := func(s string) []string { return ReplicateStrNTimes(s, 10) }
+	auditPooledFunc(t, withCap, want, "12345", "abc", "", "xyz")
+}
+
+func TestReplicateStrNTimesWithPoolCapAllocs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	// 同じnで一度使った後は、Poolから取ったSliceをそのまま使うのでアロケーションしない
+	ReplicateStrNTimesWithPoolCap("12345", 1000)
+	allocs := testing.AllocsPerRun(100, func() {
+		Result = ReplicateStrNTimesWithPoolCap("12345", 1000)
+	})
+	if allocs != 0 {
+		t.Errorf("allocs: %v, want: 0", allocs)
+	}
+}
+
+// Poolに値が残っている場合は、どちらもPoolのSliceを使い回すのでアロケーションしない
+// 差が出るのはPoolに値がない場合(Miss)で、空から始めると配列の作り直しが10回ほど起きる
+// BenchmarkReplicateStrNTimesWithPoolN1000                 1376131               896.2 ns/op             0 B/op          0 allocs/op
+// BenchmarkReplicateStrNTimesWithPoolCapN1000              1227834               996.3 ns/op             0 B/op          0 allocs/op
+// BenchmarkReplicateStrNTimesWithPoolN1000Miss               51854             23775 ns/op           35405 B/op         14 allocs/op
+// BenchmarkReplicateStrNTimesWithPoolCapN1000Miss            66856             16249 ns/op           16615 B/op          4 allocs/op
+func BenchmarkReplicateStrNTimesWithPoolN1000(b *testing.B) {
+	b.ReportAllocs()
+	var r []string
+	for n := 0; n < b.N; n++ {
+		r = ReplicateStrNTimesWithPool("12345", 1000)
+	}
+	Result = r
+}
+
+func BenchmarkReplicateStrNTimesWithPoolCapN1000(b *testing.B) {
+	b.ReportAllocs()
+	var r []string
+	for n := 0; n < b.N; n++ {
+		r = ReplicateStrNTimesWithPoolCap("12345", 1000)
+	}
+	Result = r
+}
+
+// GCでPoolが空になった直後のように、Poolに値がない場合
+// 空のSliceから始めると、appendのたびに配列を作り直す
+func BenchmarkReplicateStrNTimesWithPoolN1000Miss(b *testing.B) {
+	b.ReportAllocs()
+	var r []string
+	for n := 0; n < b.N; n++ {
+		p := &sync.Pool{New: func() interface{} { return &[]string{} }}
+		r = replicateStrNTimesWithPool(p, "12345", 1000)
+	}
+	Result = r
+}
+
+func BenchmarkReplicateStrNTimesWithPoolCapN1000Miss(b *testing.B) {
+	b.ReportAllocs()
+	var r []string
+	for n := 0; n < b.N; n++ {
+		r = replicateStrNTimesWithCapPool(&sync.Pool{}, "12345", 1000)
+	}
+	Result = r
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 上のBenchmarkは1つのgoroutineで実行していて、PoolのGetとPutが同じPのprivateで完結する一番速い場合になっている
+// b.RunParallelで複数のgoroutineから呼んだ場合も比較する
+//
+// ReplicateStrNTimesWithPoolはPoolに戻したSliceをそのまま返すので、並行に呼ぶと
+// 返した後に別のgoroutineがGetして書き換えることがある(Resultに入れた値が他の呼び出しの結果になり得る)
+// ReplicateStrNTimesWithSlicePoolは結果をコピーして返すので、その分アロケーションが増える代わりに安全
+func BenchmarkReplicateStrNTimesParallel(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var r []string
+		for pb.Next() {
+			r = ReplicateStrNTimes("12345", 5)
+		}
+		_ = r
+	})
+}
+
+func BenchmarkReplicateStrNTimesWithPoolParallel(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var r []string
+		for pb.Next() {
+			r = ReplicateStrNTimesWithPool("12345", 5)
+		}
+		_ = r
+	})
+}
+
+func BenchmarkReplicateStrNTimesWithSlicePoolParallel(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var r []string
+		for pb.Next() {
+			r = ReplicateStrNTimesWithSlicePool("12345", 5)
+		}
+		_ = r
+	})
+}
+
+// go test -run XX -bench Parallel -cpu 1,4 .
+// cpu: Intel(R) Xeon(R) Processor (1コアのマシンなので、-4でも実際には同時に動いていない)
+// BenchmarkReplicateStrNTimesParallel                  	16673142	        74.17 ns/op	      80 B/op	       1 allocs/op
+// BenchmarkReplicateStrNTimesParallel-4                	 7498292	       150.7 ns/op	      80 B/op	       1 allocs/op
+// BenchmarkReplicateStrNTimesWithPoolParallel          	53068234	        24.04 ns/op	       0 B/op	       0 allocs/op
+// BenchmarkReplicateStrNTimesWithPoolParallel-4        	48581646	        22.22 ns/op	       0 B/op	       0 allocs/op
+// BenchmarkReplicateStrNTimesWithSlicePoolParallel     	 8111977	       147.0 ns/op	      80 B/op	       1 allocs/op
+// BenchmarkReplicateStrNTimesWithSlicePoolParallel-4   	 4394770	       261.4 ns/op	      80 B/op	       1 allocs/op
+// コピーして返すとPoolを使わない場合と同じ1 allocsになり、Get/Putの分だけ遅くなる
+// 結果を呼び出し側に返す関数では、Poolの効果はほとんどない
+
+func TestReplicateStrNTimesWithPoolAliasing(t *testing.T) {
+	// ReplicateStrNTimesWithPoolの返り値はPoolに戻したSliceなので、次の呼び出しで書き換えられる
+	// 並行に呼ぶと別のgoroutineの呼び出しでも同じことが起きる
+	// sync.Poolでは次のGetで同じSliceが返るとは限らないので、TestablePoolで必ず同じSliceが返るようにして確かめる
+	p := NewTestablePool(1, func() *[]string {
+		ss := make([]string, 0, 5)
+		return &ss
+	})
+	tp := testablePoolAdapter[[]string]{p: p}
+	first := replicateStrNTimesWithPool(tp, "a", 5)
+	replicateStrNTimesWithPool(tp, "b", 5)
+	if want := []string{"b", "b", "b", "b", "b"}; !reflect.DeepEqual(first, want) {
+		t.Errorf("got: %v, want: %v", first, want)
+	}
+
+	// 同じPoolでも、コピーして返せば書き換えられない
+	copied := replicateStrNTimesCopyOut(tp, "a", 5)
+	replicateStrNTimesCopyOut(tp, "b", 5)
+	if want := []string{"a", "a", "a", "a", "a"}; !reflect.DeepEqual(copied, want) {
+		t.Errorf("copied result was overwritten: got: %v, want: %v", copied, want)
+	}
+
+	// ReplicateStrNTimesWithSlicePoolはコピーして返すので書き換えられない
+	safe := ReplicateStrNTimesWithSlicePool("a", 5)
+	ReplicateStrNTimesWithSlicePool("b", 5)
+	for _, s := range safe {
+		if s != "a" {
+			t.Errorf("copied result was overwritten: %v", safe)
+			break
+		}
+	}
+}
@@ -7,15 +7,15 @@ import (
 	"testing"
 )
 
+// 長さを固定したSliceをNewで作っておくと、それより大きいnのときにindexが範囲外になるので、
+// 空のSliceを作っておいてappendで伸ばす
 var pool = &sync.Pool{
 	New: func() interface{} {
-		mem := make([]string, 5)
-		return &mem
+		return &[]string{}
 	},
 }
 
-func ReplicateStrNTimes(s string) []string {
-	n := 5
+func ReplicateStrNTimes(s string, n int) []string {
 	ss := make([]string, n)
 	for i := 0; i < n; i++ {
 		ss[i] = s
@@ -23,17 +23,30 @@ func ReplicateStrNTimes(s string) []string {
 	return ss
 }
 
-func ReplicateStrNTimesWithPool(s string) []string {
-	n := 5
+func ReplicateStrNTimesWithPool(s string, n int) []string {
+	return replicateStrNTimesWithPool(pool, s, n)
+}
+
+// stringSlicePool は*[]stringを出し入れできるPool。*sync.PoolとTestablePoolのadapterが満たす
+type stringSlicePool interface {
+	Get() interface{}
+	Put(x interface{})
+}
+
+func replicateStrNTimesWithPool(pool stringSlicePool, s string, n int) []string {
 	ss := pool.Get().(*[]string)
 	defer pool.Put(ss)
+	// GetしたSliceは前の値を保持しているので、[:0]で空にしてからappendする
+	// 前の値の長さに頼って上書きすると、入力が変わったときに前の値が残る
+	(*ss) = (*ss)[:0]
 	for i := 0; i < n; i++ {
-		(*ss)[i] = s
+		(*ss) = append((*ss), s)
 	}
 	return *ss
 }
 
 func TestReplicateStrNTimes(t *testing.T) {
+	n := 5
 	want := []string{
 		"12345",
 		"12345",
@@ -45,13 +58,27 @@ func TestReplicateStrNTimes(t *testing.T) {
 	for i := 0; i < 2; i++ {
 		count := fmt.Sprintf("%d", i)
 		t.Run("ReplicateStrNTimes"+count, func(t *testing.T) {
-			got := ReplicateStrNTimes("12345")
+			got := ReplicateStrNTimes("12345", n)
 			if !reflect.DeepEqual(got, want) {
 				t.Errorf("got: %s, want: %s", got, want)
 			}
 		})
 		t.Run("ReplicateStrNTimesWithPool"+count, func(t *testing.T) {
-			got := ReplicateStrNTimes("12345")
+			got := ReplicateStrNTimesWithPool("12345", n)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got: %s, want: %s", got, want)
+			}
+		})
+	}
+}
+
+func TestReplicateStrNTimesWithPoolLargeN(t *testing.T) {
+	// Newで長さ5のSliceを作っていた頃は、n=10でindex out of rangeのpanicになっていた
+	// 小さいnと大きいnを交互に実行しても正しいことを確認する
+	for _, n := range []int{10, 5, 10, 1, 0, 100} {
+		t.Run(fmt.Sprintf("n=%d", n), func(t *testing.T) {
+			got := ReplicateStrNTimesWithPool("12345", n)
+			want := ReplicateStrNTimes("12345", n)
 			if !reflect.DeepEqual(got, want) {
 				t.Errorf("got: %s, want: %s", got, want)
 			}
@@ -59,13 +86,35 @@ func TestReplicateStrNTimes(t *testing.T) {
 	}
 }
 
+// auditPooledFunc はPoolを使う関数fを異なる入力で続けて実行し、それぞれの結果がwantと同じか確認する
+// Get後のResetや[:0]を忘れていると、2回目以降の結果に前の入力の値が残るのでそれを見つける
+func auditPooledFunc(t *testing.T, f, want func(s string) []string, inputs ...string) {
+	t.Helper()
+	for i := 0; i < 2; i++ {
+		for _, in := range inputs {
+			got := f(in)
+			if w := want(in); !reflect.DeepEqual(got, w) {
+				t.Errorf("input %q: got: %s, want: %s", in, got, w)
+			}
+		}
+	}
+}
+
+func TestReplicateStrNTimesWithPoolAudit(t *testing.T) {
+	for _, n := range []int{5, 10} {
+		withPool := func(s string) []string { return ReplicateStrNTimesWithPool(s, n) }
+		want := func(s string) []string { return ReplicateStrNTimes(s, n) }
+		auditPooledFunc(t, withPool, want, "12345", "abc", "", "xyz")
+	}
+}
+
 var Result []string
 
 func BenchmarkReplicateStrNTimes(b *testing.B) {
 	b.ReportAllocs()
 	var r []string
 	for n := 0; n < b.N; n++ {
-		r = ReplicateStrNTimes("12345")
+		r = ReplicateStrNTimes("12345", 5)
 	}
 	Result = r
 }
@@ -74,7 +123,7 @@ func BenchmarkReplicateStrNTimesWithPool(b *testing.B) {
 	b.ReportAllocs()
 	var r []string
 	for n := 0; n < b.N; n++ {
-		r = ReplicateStrNTimesWithPool("12345")
+		r = ReplicateStrNTimesWithPool("12345", 5)
 	}
 	Result = r
 }
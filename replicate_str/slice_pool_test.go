@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// 要素の型ごとの*sync.Pool。GetSlice[T]/PutSlice[T]で使う
+var slicePools sync.Map // map[reflect.Type]*sync.Pool
+
+func slicePool[T any]() *sync.Pool {
+	typ := reflect.TypeFor[T]()
+	if p, ok := slicePools.Load(typ); ok {
+		return p.(*sync.Pool)
+	}
+	p, _ := slicePools.LoadOrStore(typ, &sync.Pool{
+		New: func() interface{} {
+			return &[]T{}
+		},
+	})
+	return p.(*sync.Pool)
+}
+
+// GetSlice は長さ0でcapがminCap以上の*[]TをPoolから返す
+// 使い終わったらPutSliceで戻す。Putした後にSliceを使ってはいけない
+func GetSlice[T any](minCap int) *[]T {
+	s := slicePool[T]().Get().(*[]T)
+	if cap(*s) < minCap {
+		*s = make([]T, 0, minCap)
+	}
+	*s = (*s)[:0]
+	return s
+}
+
+// PutSlice はGetSliceで取得したSliceをPoolに戻す
+// 要素が参照している値をGCできるように、中身をゼロ値にしてから戻す
+func PutSlice[T any](s *[]T) {
+	clear(*s)
+	*s = (*s)[:0]
+	slicePool[T]().Put(s)
+}
+
+// ReplicateStrNTimesWithSlicePool はGetSliceを使ってsをn個並べる。結果はPoolのSliceからコピーしたもの
+func ReplicateStrNTimesWithSlicePool(s string, n int) []string {
+	ss := GetSlice[string](n)
+	defer PutSlice(ss)
+	for i := 0; i < n; i++ {
+		*ss = append(*ss, s)
+	}
+	res := make([]string, len(*ss))
+	copy(res, *ss)
+	return res
+}
+
+func TestGetSlice(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		for _, minCap := range []int{0, 5, 100, 3} {
+			is := GetSlice[int](minCap)
+			if len(*is) != 0 || cap(*is) < minCap {
+				t.Errorf("[]int: got len %d cap %d, want len 0 cap >= %d", len(*is), cap(*is), minCap)
+			}
+			for j := 0; j < minCap; j++ {
+				*is = append(*is, j)
+			}
+			PutSlice(is)
+
+			ss := GetSlice[string](minCap)
+			if len(*ss) != 0 || cap(*ss) < minCap {
+				t.Errorf("[]string: got len %d cap %d, want len 0 cap >= %d", len(*ss), cap(*ss), minCap)
+			}
+			*ss = append(*ss, "12345")
+			PutSlice(ss)
+		}
+	}
+}
+
+func TestPutSliceClears(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	slicePool[string]().Get() // per-Pのprivateを空にしておく
+	ss := GetSlice[string](2)
+	*ss = append(*ss, "a", "b")
+	PutSlice(ss)
+
+	got := GetSlice[string](2)
+	defer PutSlice(got)
+	if got != ss {
+		t.Fatal("want the same slice back from the pool")
+	}
+	// capの範囲に前の値が残っていない
+	for i, v := range (*got)[:2] {
+		if v != "" {
+			t.Errorf("index %d: got %q, want empty", i, v)
+		}
+	}
+}
+
+func TestGetSliceZeroAllocs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	PutSlice(GetSlice[int](10))
+	allocs := testing.AllocsPerRun(100, func() {
+		s := GetSlice[int](10)
+		for i := 0; i < 10; i++ {
+			*s = append(*s, i)
+		}
+		PutSlice(s)
+	})
+	if allocs != 0 {
+		t.Errorf("got %v allocs, want 0", allocs)
+	}
+}
+
+func TestReplicateStrNTimesWithSlicePool(t *testing.T) {
+	for _, n := range []int{10, 5, 0, 100} {
+		got := ReplicateStrNTimesWithSlicePool("12345", n)
+		if want := ReplicateStrNTimes("12345", n); !reflect.DeepEqual(got, want) {
+			t.Errorf("n=%d: got: %s, want: %s", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestablePool はchannelで値を持つPool
+// sync.PoolはGCやgoroutineの切り替わりで中身が変わるので、テストでPoolの中身を決めることができない
+// TestablePoolはSnapshotで中身を取り出し、Restoreで好きな状態にできるので、Poolの中に残った値が原因の不具合を再現できる
+// 容量を超えてPutされた値は捨てる
+type TestablePool[T any] struct {
+	New   func() *T
+	items chan *T
+}
+
+func NewTestablePool[T any](size int, newFunc func() *T) *TestablePool[T] {
+	return &TestablePool[T]{
+		New:   newFunc,
+		items: make(chan *T, size),
+	}
+}
+
+// Get はPoolに値があれば最も古く入れたものを、なければNewで作ったものを返す
+func (p *TestablePool[T]) Get() *T {
+	select {
+	case x := <-p.items:
+		return x
+	default:
+		return p.New()
+	}
+}
+
+// Put はxをPoolに戻す。Poolがいっぱいならxは捨てる
+func (p *TestablePool[T]) Put(x *T) {
+	select {
+	case p.items <- x:
+	default:
+	}
+}
+
+// Snapshot はPoolの中身を入っている順番で返す。Poolの中身は変わらない
+func (p *TestablePool[T]) Snapshot() []*T {
+	res := p.drain()
+	for _, x := range res {
+		p.items <- x
+	}
+	return res
+}
+
+// Restore はPoolの中身をitemsに置き換える。容量を超えた分は捨てる
+func (p *TestablePool[T]) Restore(items []*T) {
+	p.drain()
+	for _, x := range items {
+		p.Put(x)
+	}
+}
+
+func (p *TestablePool[T]) drain() []*T {
+	var res []*T
+	for {
+		select {
+		case x := <-p.items:
+			res = append(res, x)
+		default:
+			return res
+		}
+	}
+}
+
+// testablePoolAdapter はTestablePoolをsync.Poolと同じGet/Putの形で使えるようにする
+type testablePoolAdapter[T any] struct {
+	p *TestablePool[T]
+}
+
+func (a testablePoolAdapter[T]) Get() interface{} {
+	return a.p.Get()
+}
+
+func (a testablePoolAdapter[T]) Put(x interface{}) {
+	a.p.Put(x.(*T))
+}
+
+// replicateStrNTimesCopyOut はreplicateStrNTimesWithPoolと同じだが、結果をPoolのSliceからコピーして返す
+func replicateStrNTimesCopyOut(pool stringSlicePool, s string, n int) []string {
+	ss := pool.Get().(*[]string)
+	defer pool.Put(ss)
+	(*ss) = (*ss)[:0]
+	for i := 0; i < n; i++ {
+		(*ss) = append((*ss), s)
+	}
+	res := make([]string, len(*ss))
+	copy(res, *ss)
+	return res
+}
+
+func TestTestablePoolSnapshotRestore(t *testing.T) {
+	newCount := 0
+	p := NewTestablePool(2, func() *[]string {
+		newCount++
+		return &[]string{}
+	})
+	a, b, c := &[]string{"a"}, &[]string{"b"}, &[]string{"c"}
+
+	p.Restore([]*[]string{a, b, c}) // 容量は2なのでcは捨てられる
+	if got := p.Snapshot(); !reflect.DeepEqual(got, []*[]string{a, b}) {
+		t.Errorf("got: %v, want: %v", got, []*[]string{a, b})
+	}
+	// Snapshotしても中身は変わらない
+	if got := p.Get(); got != a {
+		t.Errorf("got: %v, want: %v", got, a)
+	}
+	if got := p.Get(); got != b {
+		t.Errorf("got: %v, want: %v", got, b)
+	}
+	if newCount != 0 {
+		t.Errorf("New was called %d times, want 0", newCount)
+	}
+	p.Get()
+	if newCount != 1 {
+		t.Errorf("New was called %d times, want 1", newCount)
+	}
+
+	p.Put(c)
+	p.Restore(nil)
+	if got := p.Snapshot(); len(got) != 0 {
+		t.Errorf("got: %v, want empty", got)
+	}
+}
+
+func TestTestablePoolStaleObject(t *testing.T) {
+	p := NewTestablePool(1, func() *[]string {
+		return &[]string{}
+	})
+
+	// 前の呼び出しの結果を呼び出し元がまだ持っている状態で、そのSliceがPoolに残っている
+	prev := replicateStrNTimesWithPool(testablePoolAdapter[[]string]{p}, "a", 3)
+	stale := p.Snapshot()
+	if len(stale) != 1 {
+		t.Fatalf("got %d items in pool, want 1", len(stale))
+	}
+
+	t.Run("WithPool", func(t *testing.T) {
+		p.Restore(stale)
+		got := replicateStrNTimesWithPool(testablePoolAdapter[[]string]{p}, "b", 3)
+		if want := []string{"b", "b", "b"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got: %v, want: %v", got, want)
+		}
+		// Poolに残っていたSliceを使いまわすので、前の結果が書き換えられてしまう
+		if want := []string{"b", "b", "b"}; !reflect.DeepEqual(prev, want) {
+			t.Errorf("prev: %v, want it to be overwritten to %v", prev, want)
+		}
+	})
+
+	t.Run("CopyOut", func(t *testing.T) {
+		prev := replicateStrNTimesCopyOut(testablePoolAdapter[[]string]{p}, "a", 3)
+		p.Restore(stale)
+		got := replicateStrNTimesCopyOut(testablePoolAdapter[[]string]{p}, "b", 3)
+		if want := []string{"b", "b", "b"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got: %v, want: %v", got, want)
+		}
+		// コピーして返しているので、Poolに何が残っていても前の結果は変わらない
+		if want := []string{"a", "a", "a"}; !reflect.DeepEqual(prev, want) {
+			t.Errorf("prev: %v, want: %v", prev, want)
+		}
+	})
+}
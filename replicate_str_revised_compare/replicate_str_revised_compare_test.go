@@ -90,6 +90,27 @@ func TestReplicateStrNTimes(t *testing.T) {
 	}
 }
 
+func TestReplicateStrNTimesWithPoolUseArrayAllocs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip in short mode: sync.Pool drops values at random under the race detector")
+	}
+	// 下の古いベンチマーク結果ではUseArrayが4 allocs(240B = 16+32+64+128)になっていて、
+	// appendで毎回空のSliceから伸ばし直している、つまりPutしたSliceがGetで返ってきていない状態だった
+	// *ss = arrayで伸ばしたSliceを書き戻してからPutしていれば、2回目以降は0 allocsになる
+	for name, f := range map[string]func(s string, n int) []string{
+		"ReplicateStrNTimesWithPool":         ReplicateStrNTimesWithPool,
+		"ReplicateStrNTimesWithPoolUseArray": ReplicateStrNTimesWithPoolUseArray,
+	} {
+		f("12345", 5) // Poolに十分なcapのSliceを入れておく
+		allocs := testing.AllocsPerRun(100, func() {
+			Result = f("12345", 5)
+		})
+		if allocs != 0 {
+			t.Errorf("%s: got %v allocs, want 0", name, allocs)
+		}
+	}
+}
+
 var Result []string
 
 func BenchmarkReplicateStrNTimes(b *testing.B) {
@@ -138,3 +159,15 @@ func BenchmarkReplicateStrNTimesWithPoolUseArray(b *testing.B) {
 // BenchmarkReplicateStrNTimesWithPoolUseArray-8            3317565               329.1 ns/op           240 B/op          4 allocs/op
 // PASS
 // ok      github.com/ludwig125/sync-pool/replicate_str_revised_compare    14.928s
+
+// 上の結果のUseArrayの4 allocsは今のコードでは再現せず、WithPoolと同じく0 allocsになる
+// $go test -bench . -count=2
+// goos: linux
+// goarch: amd64
+// cpu: Intel(R) Xeon(R) Processor
+// BenchmarkReplicateStrNTimes                 	29929269	        39.27 ns/op	      80 B/op	       1 allocs/op
+// BenchmarkReplicateStrNTimes                 	31542842	        39.18 ns/op	      80 B/op	       1 allocs/op
+// BenchmarkReplicateStrNTimesWithPool         	59391039	        22.62 ns/op	       0 B/op	       0 allocs/op
+// BenchmarkReplicateStrNTimesWithPool         	57129091	        21.14 ns/op	       0 B/op	       0 allocs/op
+// BenchmarkReplicateStrNTimesWithPoolUseArray 	57565456	        20.56 ns/op	       0 B/op	       0 allocs/op
+// BenchmarkReplicateStrNTimesWithPoolUseArray 	58592642	        20.23 ns/op	       0 B/op	       0 allocs/op